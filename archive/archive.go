@@ -1,183 +1,674 @@
 package archive
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/bodgit/sevenzip"
 	"github.com/nwaples/rardecode"
 )
 
-type Filter func(name string) bool
-
 type Archive interface {
-	Extract(dest string, filter Filter) (map[string]string, error)
+	// Extract writes all entries accepted by opts.Filter to dest and
+	// returns a Result for each entry keyed by its name in the archive.
+	Extract(dest string, opts Options) (map[string]Result, error)
+	// Entries lists all regular files in the archive.
+	Entries() ([]Entry, error)
+	// Open opens the entry with the given name as listed by Entries.
+	Open(name string) (io.ReadCloser, error)
+	// Close releases the temporary file NewReader might have created.
+	Close() error
+}
+
+// Entry describes a single file in an archive.
+type Entry struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+	// Packed is the compressed size, -1 if unknown.
+	Packed int64
+	// Method is the compression method, empty if unknown.
+	Method string
+}
+
+type opener func() (io.ReadCloser, error)
+
+// walker is implemented by all archives, fn is called for each regular
+// file until it returns stop or an error.
+type walker interface {
+	walk(fn func(e Entry, open opener) (stop bool, err error)) error
+	readerOptions() ReaderOptions
 }
 
 type ZipArchive struct {
+	common
 	zip *zip.Reader
 }
 type RarArchive struct {
-	rar *rardecode.Reader
+	common
+	src      *io.SectionReader
+	path     string
+	password string
+}
+type SevenZipArchive struct {
+	common
+	sz *sevenzip.Reader
+}
+type TarArchive struct {
+	common
+	src *io.SectionReader
+	gz  bool
 }
 
-func NewReader(mime string, r io.Reader, size int64) (Archive, error) {
-	var err error
-	var a Archive
+// SingleArchive is a single uncompressed or gzipped file that is not an
+// archive at all.
+type SingleArchive struct {
+	common
+	name string
+	src  *io.SectionReader
+	gz   bool
+	// size is the decompressed size of a gzipped file, -1 until the
+	// first walk.
+	size int64
+}
+
+// common holds the file an archive was spilled to, which is removed on
+// Close, and the options it was opened with so nested archives can be
+// opened the same way.
+type common struct {
+	f    *os.File
+	opts ReaderOptions
+}
+
+func (c common) readerOptions() ReaderOptions { return c.opts }
+
+func (c common) Close() error {
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	if rerr := os.Remove(c.f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+var (
+	ErrUnsupported = errors.New("unsupported archive format")
+	ErrTooLarge    = errors.New("body too large")
+	// ErrEncrypted is returned for encrypted archives or entries when no
+	// or the wrong password was given.
+	ErrEncrypted = errors.New("archive is encrypted")
+)
+
+// ReaderOptions configure NewReader.
+type ReaderOptions struct {
+	// MaxSize is the maximum number of bytes read, defaults to
+	// DefaultMaxSize.
+	MaxSize int64
+	// SpillSize is the size above which the archive is written to a
+	// temporary file in TempDir instead of being kept in memory,
+	// defaults to DefaultSpillSize.
+	SpillSize int64
+	TempDir   string
+	// Password is used to decrypt rar and 7z archives.
+	Password string
+	// PasswordFunc is called with the archive's name when a rar archive
+	// is encrypted and Password is empty or incorrect. Returning an empty
+	// password gives up.
+	PasswordFunc func(name string) (string, error)
+}
+
+const (
+	DefaultMaxSize   = 1024 * 1024 * 80
+	DefaultSpillSize = 1024 * 1024 * 4
+
+	maxPasswordAttempts = 3
+)
+
+var (
+	magicZip      = []byte("PK\x03\x04")
+	magicZipEmpty = []byte("PK\x05\x06")
+	magicRar      = []byte("Rar!\x1a\x07")
+	magic7z       = []byte("7z\xbc\xaf\x27\x1c")
+	magicGzip     = []byte("\x1f\x8b")
+	magicTar      = []byte("ustar")
+)
+
+const sniffLen = 512
+
+// NewReader detects the archive format of r from its first bytes.
+// Zip, rar, 7z, tar, tar.gz are supported as well as a single gzipped or
+// plain text file, which is exposed as an archive with one entry.
+// size is the length of r or -1 if unknown and name the filename the server
+// suggested, it is used to name single file archives.
+// r is read completely, into memory or into a temporary file depending on
+// its size, so entries can be accessed in any order. The returned Archive
+// should be closed.
+func NewReader(r io.Reader, size int64, name string, opts ReaderOptions) (Archive, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.SpillSize <= 0 {
+		opts.SpillSize = DefaultSpillSize
+	}
+	if size > opts.MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	memSize := opts.SpillSize
+	if size >= 0 && size < memSize {
+		memSize = size
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r, memSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) <= memSize {
+		src := io.NewSectionReader(bytes.NewReader(buf), 0, int64(len(buf)))
+		return newArchive(src, name, common{opts: opts})
+	}
+
+	f, err := os.CreateTemp(opts.TempDir, "subscene-*.archive")
+	if err != nil {
+		return nil, err
+	}
+	c := common{f, opts}
+
+	n, err := io.Copy(f, io.LimitReader(io.MultiReader(bytes.NewReader(buf), r), opts.MaxSize+1))
+	if err == nil && n > opts.MaxSize {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	a, err := newArchive(io.NewSectionReader(f, 0, n), name, c)
+	if err != nil {
+		_ = c.Close()
+	}
+	return a, err
+}
+
+func newArchive(src *io.SectionReader, name string, c common) (Archive, error) {
+	head, err := peek(src)
+	if err != nil {
+		return nil, err
+	}
 
-	switch mime {
-	case "application/x-rar-compressed":
-		r, err := rardecode.NewReader(r, "")
+	switch {
+	case bytes.HasPrefix(head, magicZip), bytes.HasPrefix(head, magicZipEmpty):
+		z, err := zip.NewReader(src, src.Size())
 		if err != nil {
-			return a, err
+			return nil, err
 		}
 
-		return &RarArchive{r}, nil
-	case "application/x-zip-compressed":
-		r := io.LimitReader(r, size)
-		buf := make([]byte, size)
-		_, err = io.ReadFull(r, buf)
+		return &ZipArchive{c, z}, nil
+	case bytes.HasPrefix(head, magicRar):
+		return newRar(src, name, c)
+	case bytes.HasPrefix(head, magic7z):
+		sz, err := sevenzip.NewReaderWithPassword(src, src.Size(), c.opts.Password)
 		if err != nil {
-			return a, err
+			return nil, err
 		}
 
-		z, err := zip.NewReader(bytes.NewReader(buf), size)
+		return &SevenZipArchive{c, sz}, nil
+	case bytes.HasPrefix(head, magicGzip):
+		gz, err := gzip.NewReader(section(src))
 		if err != nil {
-			return a, err
+			return nil, err
 		}
 
-		return &ZipArchive{z}, nil
+		inner := gz.Name
+		if inner == "" {
+			inner = strings.TrimSuffix(name, filepath.Ext(name))
+			if strings.EqualFold(filepath.Ext(name), ".tgz") {
+				inner += ".tar"
+			}
+		}
+
+		head, err := peek(gz)
+		if err != nil {
+			return nil, err
+		}
+		if isTar(head) {
+			return &TarArchive{c, src, true}, nil
+		}
+		ext := subtitleExt(head)
+		if ext == "" {
+			return nil, ErrUnsupported
+		}
+
+		return &SingleArchive{c, singleName(inner, ext), src, true, -1}, nil
+	case isTar(head):
+		return &TarArchive{c, src, false}, nil
+	case subtitleExt(head) != "":
+		return &SingleArchive{c, singleName(name, subtitleExt(head)), src, false, -1}, nil
 	}
 
-	return a, fmt.Errorf("mimetype '%s' not supported", mime)
+	return nil, ErrUnsupported
+}
+
+func section(s *io.SectionReader) *io.SectionReader {
+	return io.NewSectionReader(s, 0, s.Size())
 }
 
-type dest struct {
-	d   string
-	dir bool
+func peek(r io.Reader) ([]byte, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
 }
 
-func newDest(path string) *dest {
-	stat, _ := os.Stat(path)
-	isDir := stat != nil && stat.IsDir()
-	return &dest{path, isDir}
+func isTar(head []byte) bool {
+	return len(head) >= 262 && bytes.Equal(head[257:262], magicTar)
 }
 
-func (d *dest) file(name string) (ok bool, tmp, real string) {
-	real = d.d
-	if d.dir {
-		real = filepath.Join(d.d, name)
+var (
+	// subtitleSigs recognize the start of the subtitle formats that are
+	// served without an archive around them, SRT is tried last as WebVTT
+	// uses the same timing lines.
+	subtitleSigs = []struct {
+		re  *regexp.Regexp
+		ext string
+	}{
+		{regexp.MustCompile(`(?i)^webvtt`), ".vtt"},
+		{regexp.MustCompile(`(?i)^\[script info\]`), ".ass"},
+		{regexp.MustCompile(`(?i)^<sami`), ".smi"},
+		{regexp.MustCompile(`^\{\d+\}\{\d*\}`), ".sub"},
+		{regexp.MustCompile(`^(?:\d+[ \t]*\r?\n)?(?:\d+:)?\d+:\d+[,.]\d+[ \t]*-->`), ".srt"},
 	}
+	htmlRE = regexp.MustCompile(`(?i)<(?:!doctype|html)`)
+)
 
-	stat, _ := os.Stat(real)
-	ok = stat == nil
+// subtitleExt returns the extension of the subtitle head is the start of,
+// i.e.: one that was served without an archive around it. Anything else,
+// like an error page, returns "".
+func subtitleExt(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xff, 0xfe}):
+		head = utf16ASCII(head[2:], 1)
+	case bytes.HasPrefix(head, []byte{0xfe, 0xff}):
+		head = utf16ASCII(head[2:], 0)
+	}
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+
+	for _, b := range head {
+		if b == 0 || (b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f') {
+			return ""
+		}
+	}
+	if htmlRE.Match(head) {
+		return ""
+	}
+	head = bytes.TrimLeft(head, " \t\r\n\f")
+	for _, sig := range subtitleSigs {
+		if sig.re.Match(head) {
+			return sig.ext
+		}
+	}
+	return ""
+}
 
-	tmp = real + ".tmp"
-	return
+// utf16ASCII turns UTF-16 into ASCII, which is enough to recognize the
+// start of a subtitle, anything else becomes '?'.
+func utf16ASCII(b []byte, hi int) []byte {
+	ascii := make([]byte, 0, len(b)/2)
+	for i := 0; i < len(b)-1; i += 2 {
+		c := b[i+1-hi]
+		if b[i+hi] != 0 || c >= 0x80 {
+			c = '?'
+		}
+		ascii = append(ascii, c)
+	}
+	return ascii
 }
 
-func (d *dest) single() bool { return !d.dir }
+// singleName names a bare subtitle, the extension is taken from its
+// contents if name has none.
+func singleName(name, ext string) string {
+	if name == "" {
+		name = "subtitle"
+	}
+	if filepath.Ext(name) == "" {
+		name += ext
+	}
+	return name
+}
 
-func (d *dest) read(r io.Reader, name string) (bool, string, error) {
-	ok, tmp, real := d.file(name)
-	if !ok {
-		return false, real, nil
+func zipMethod(m uint16) string {
+	switch m {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
 	}
+	return fmt.Sprintf("method %d", m)
+}
 
-	f, err := os.Create(tmp)
+func newRar(src *io.SectionReader, name string, c common) (*RarArchive, error) {
+	info, err := rarScan(src, src.Size())
 	if err != nil {
-		return false, real, err
+		return nil, err
+	}
+	if info.incomplete() {
+		return nil, volumeError(name, info)
+	}
+
+	return (&RarArchive{common: c, src: src}).unlock(name, info.encrypted)
+}
+
+// unlock finds the password for an encrypted archive.
+func (r *RarArchive) unlock(name string, encrypted bool) (*RarArchive, error) {
+	if !encrypted {
+		_, closer, err := r.reader()
+		if err != nil {
+			return nil, err
+		}
+		return r, closer()
+	}
+
+	var err error
+	r.password = r.opts.Password
+	for i := 0; ; i++ {
+		if r.password != "" && r.check() == nil {
+			return r, nil
+		}
+		if r.opts.PasswordFunc == nil || i == maxPasswordAttempts {
+			break
+		}
+		if r.password, err = r.opts.PasswordFunc(name); err != nil {
+			return nil, err
+		}
+		if r.password == "" {
+			return nil, ErrEncrypted
+		}
 	}
-	if _, err = io.Copy(f, r); err != nil {
-		_ = f.Close()
-		_ = os.Remove(tmp)
-		return false, real, err
+
+	if r.password != "" {
+		return nil, fmt.Errorf("%w: incorrect password", ErrEncrypted)
 	}
+	return nil, ErrEncrypted
+}
 
-	_ = f.Close()
-	if err = os.Rename(tmp, real); err != nil {
-		_ = os.Remove(tmp)
-		return false, real, err
+// reader opens the archive, path is used for multi-volume archives which
+// rardecode can only read from disk.
+func (r *RarArchive) reader() (*rardecode.Reader, func() error, error) {
+	if r.path != "" {
+		rc, err := rardecode.OpenReader(r.path, r.password)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &rc.Reader, rc.Close, nil
 	}
 
-	return true, real, nil
+	rar, err := rardecode.NewReader(section(r.src), r.password)
+	return rar, func() error { return nil }, err
 }
 
-func (r *RarArchive) Extract(dest string, filter Filter) (map[string]string, error) {
-	files := make(map[string]string)
+// check reads all entries, rardecode does not verify passwords so a wrong
+// one only shows as corrupt headers or checksum mismatches.
+func (r *RarArchive) check() error {
+	return r.walk(func(_ Entry, open opener) (bool, error) {
+		rc, err := open()
+		if err != nil {
+			return true, err
+		}
+		_, err = io.Copy(io.Discard, rc)
+		return err != nil, err
+	})
+}
 
-	destination := newDest(dest)
+func (r *RarArchive) walk(fn func(Entry, opener) (bool, error)) error {
+	rar, closer, err := r.reader()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closer != nil {
+			_ = closer()
+		}
+	}()
 
 	for {
-		inode, err := r.rar.Next()
+		inode, err := rar.Next()
 		if err != nil {
 			if err == io.EOF {
 				err = nil
 			}
-
-			return files, err
+			return err
 		}
 		if inode.IsDir {
 			continue
 		}
 
-		clean := filepath.Base(filepath.Clean(inode.Name))
-		files[clean] = ""
-
-		if !filter(clean) {
-			continue
+		size := inode.UnPackedSize
+		if inode.UnKnownSize {
+			size = -1
 		}
-
-		ok, fn, err := destination.read(r.rar, clean)
-		if err != nil {
-			return files, err
+		e := Entry{
+			Name:     inode.Name,
+			Size:     size,
+			Modified: inode.ModificationTime,
+			Packed:   inode.PackedSize,
 		}
-
-		if ok {
-			files[clean] = fn
-			if destination.single() {
-				break
+		var rc *rarEntry
+		stop, err := fn(e, func() (io.ReadCloser, error) {
+			rc = &rarEntry{Reader: rar}
+			return rc, nil
+		})
+		if stop || err != nil {
+			// The entry is read after walk returns, the volumes are
+			// closed with it instead.
+			if rc != nil && !rc.closed {
+				rc.close, closer = closer, nil
 			}
+			return err
 		}
 	}
+}
 
-	return files, nil
+// rarEntry is the reader of a single rar entry.
+type rarEntry struct {
+	io.Reader
+	closed bool
+	close  func() error
+}
+
+func (r *rarEntry) Close() error {
+	r.closed = true
+	if r.close == nil {
+		return nil
+	}
+	return r.close()
 }
 
-func (z *ZipArchive) Extract(dest string, filter Filter) (map[string]string, error) {
-	files := make(map[string]string, len(z.zip.File))
+func (z *ZipArchive) walk(fn func(Entry, opener) (bool, error)) error {
 	for _, inode := range z.zip.File {
-		files[inode.Name] = ""
+		if inode.FileInfo().IsDir() {
+			continue
+		}
+
+		e := Entry{
+			Name:     inode.Name,
+			Size:     int64(inode.UncompressedSize64),
+			Modified: inode.Modified,
+			Packed:   int64(inode.CompressedSize64),
+			Method:   zipMethod(inode.Method),
+		}
+		open := inode.Open
+		if inode.Flags&0x1 != 0 {
+			open = func() (io.ReadCloser, error) { return nil, ErrEncrypted }
+		}
+		stop, err := fn(e, open)
+		if stop || err != nil {
+			return err
+		}
 	}
 
-	destination := newDest(dest)
+	return nil
+}
 
-	for _, inode := range z.zip.File {
-		clean := filepath.Base(filepath.Clean(inode.Name))
-		if !filter(clean) {
+func (s *SevenZipArchive) walk(fn func(Entry, opener) (bool, error)) error {
+	for _, inode := range s.sz.File {
+		if inode.FileInfo().IsDir() {
 			continue
 		}
 
-		zf, err := z.zip.Open(inode.Name)
+		e := Entry{
+			Name:     inode.Name,
+			Size:     int64(inode.UncompressedSize),
+			Modified: inode.Modified,
+			Packed:   -1,
+		}
+		stop, err := fn(e, inode.Open)
+		if stop || err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *TarArchive) walk(fn func(Entry, opener) (bool, error)) error {
+	var r io.Reader = section(t.src)
+	method := "store"
+	if t.gz {
+		gz, err := gzip.NewReader(r)
 		if err != nil {
-			return files, err
+			return err
 		}
+		r, method = gz, "gzip"
+	}
 
-		ok, fn, err := destination.read(zf, clean)
+	tr := tar.NewReader(r)
+	for {
+		inode, err := tr.Next()
 		if err != nil {
-			return files, err
+			if err == io.EOF {
+				err = nil
+			}
+			return err
+		}
+		if inode.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		e := Entry{
+			Name:     inode.Name,
+			Size:     inode.Size,
+			Modified: inode.ModTime,
+			Packed:   -1,
+			Method:   method,
 		}
+		stop, err := fn(e, func() (io.ReadCloser, error) {
+			return io.NopCloser(tr), nil
+		})
+		if stop || err != nil {
+			return err
+		}
+	}
+}
+
+func (s *SingleArchive) walk(fn func(Entry, opener) (bool, error)) error {
+	e := Entry{Name: s.name, Size: s.src.Size(), Packed: s.src.Size(), Method: "store"}
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(section(s.src)), nil
+	}
 
-		if ok {
-			files[clean] = fn
-			if destination.single() {
-				break
+	if s.gz {
+		gz, err := gzip.NewReader(section(s.src))
+		if err != nil {
+			return err
+		}
+		if s.size < 0 {
+			n, err := io.Copy(io.Discard, gz)
+			if err != nil {
+				return err
 			}
+			s.size = n
 		}
+		e.Size, e.Modified, e.Method = s.size, gz.ModTime, "gzip"
+		open = func() (io.ReadCloser, error) {
+			return gzip.NewReader(section(s.src))
+		}
+	}
+
+	_, err := fn(e, open)
+	return err
+}
+
+func entries(a walker) ([]Entry, error) {
+	list := make([]Entry, 0)
+	err := a.walk(func(e Entry, _ opener) (bool, error) {
+		list = append(list, e)
+		return false, nil
+	})
+	return list, err
+}
+
+func open(a walker, name string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := a.walk(func(e Entry, open opener) (bool, error) {
+		if e.Name != name {
+			return false, nil
+		}
+		var err error
+		rc, err = open()
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rc == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 	}
+	return rc, nil
+}
+
+func (r *RarArchive) Extract(dest string, opts Options) (map[string]Result, error) {
+	return extractAll(r, dest, opts)
+}
+
+func (z *ZipArchive) Extract(dest string, opts Options) (map[string]Result, error) {
+	return extractAll(z, dest, opts)
+}
 
-	return files, nil
+func (s *SevenZipArchive) Extract(dest string, opts Options) (map[string]Result, error) {
+	return extractAll(s, dest, opts)
 }
+
+func (t *TarArchive) Extract(dest string, opts Options) (map[string]Result, error) {
+	return extractAll(t, dest, opts)
+}
+
+func (s *SingleArchive) Extract(dest string, opts Options) (map[string]Result, error) {
+	return extractAll(s, dest, opts)
+}
+
+func (r *RarArchive) Entries() ([]Entry, error)      { return entries(r) }
+func (z *ZipArchive) Entries() ([]Entry, error)      { return entries(z) }
+func (s *SevenZipArchive) Entries() ([]Entry, error) { return entries(s) }
+func (t *TarArchive) Entries() ([]Entry, error)      { return entries(t) }
+func (s *SingleArchive) Entries() ([]Entry, error)   { return entries(s) }
+
+func (r *RarArchive) Open(name string) (io.ReadCloser, error)      { return open(r, name) }
+func (z *ZipArchive) Open(name string) (io.ReadCloser, error)      { return open(z, name) }
+func (s *SevenZipArchive) Open(name string) (io.ReadCloser, error) { return open(s, name) }
+func (t *TarArchive) Open(name string) (io.ReadCloser, error)      { return open(t, name) }
+func (s *SingleArchive) Open(name string) (io.ReadCloser, error)   { return open(s, name) }
@@ -0,0 +1,765 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testZip(t *testing.T, files map[string]string) Archive {
+	t.Helper()
+	buf := zipBytes(t, files)
+	a, err := NewReader(bytes.NewReader(buf), int64(len(buf)), "test.zip", ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCleanName(t *testing.T) {
+	ok := map[string]string{
+		"movie.srt":             "movie.srt",
+		"subs/movie.srt":        "movie.srt",
+		"../../../etc/cron.d/x": "x",
+		`..\..\evil.srt`:        "evil.srt",
+		"console.srt":           "console.srt",
+		"Movie: Sequel?.srt":    "Movie_ Sequel_.srt",
+		"movie.srt. . ":         "movie.srt",
+		"tab\tname<1>.srt":      "tab_name_1_.srt",
+		"COM10.srt":             "COM10.srt",
+	}
+	for in, exp := range ok {
+		clean, err := cleanName(in)
+		if err != nil || clean != exp {
+			t.Errorf("%q: expected %q, got %q %v", in, exp, clean, err)
+		}
+	}
+
+	bad := []string{
+		"movie\x00.srt",
+		"CON",
+		"con.srt",
+		"LPT1.en.srt",
+		"com0.srt",
+		"LPT².srt",
+		"NUL .srt",
+		"CON. ",
+		"..",
+		"...",
+		strings.Repeat("a", 300) + ".srt",
+	}
+	for _, in := range bad {
+		var nerr *NameError
+		if _, err := cleanName(in); !errors.As(err, &nerr) {
+			t.Errorf("%q: expected a NameError, got %v", in, err)
+		}
+	}
+}
+
+func TestExtractUnsafe(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	target := filepath.Join(outside, "target.srt")
+	if err := os.Symlink(target, filepath.Join(dir, "link.srt")); err != nil {
+		t.Fatal(err)
+	}
+
+	a := testZip(t, map[string]string{
+		"../../slip.srt": "slip",
+		"link.srt":       "link",
+		"ok.srt":         "ok",
+		"aux.srt":        "aux",
+	})
+
+	res, err := a.Extract(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res["../../slip.srt"].Path != filepath.Join(dir, "slip.srt") {
+		t.Errorf("unexpected result for slip.srt %+v", res["../../slip.srt"])
+	}
+	if !errors.Is(res["link.srt"].Err, ErrSymlink) {
+		t.Errorf("expected ErrSymlink, got %+v", res["link.srt"])
+	}
+	if _, err := os.Stat(target); err == nil {
+		t.Error("wrote through symlink")
+	}
+	if res["aux.srt"].Err == nil || res["aux.srt"].Path != "" {
+		t.Errorf("expected aux.srt to be rejected, got %+v", res["aux.srt"])
+	}
+	if res["ok.srt"].Path == "" {
+		t.Errorf("expected ok.srt to be extracted, got %+v", res["ok.srt"])
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("leftover temp file %s", e.Name())
+		}
+	}
+}
+
+const srt = "1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n"
+
+func testTar(t *testing.T, name, data string) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	w := tar.NewWriter(buf)
+	err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gz(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	w := gzip.NewWriter(buf)
+	w.Name = name
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewReaderFormats(t *testing.T) {
+	sevenZip, err := os.ReadFile("testdata/movie.7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vtt := "WEBVTT\n\n00:01.000 --> 00:02.000\nHi\n"
+	ass := "[Script Info]\nTitle: x\n"
+	tests := []struct {
+		name     string
+		data     []byte
+		entry    string
+		contents string
+	}{
+		{"movie.tar", testTar(t, "dir/movie.srt", srt), "dir/movie.srt", srt},
+		{"movie.tgz", gz(t, "", testTar(t, "movie.srt", srt)), "movie.srt", srt},
+		{"movie.srt.gz", gz(t, "", []byte(srt)), "movie.srt", srt},
+		{"download", gz(t, "named.srt", []byte(srt)), "named.srt", srt},
+		{"movie.srt", []byte(srt), "movie.srt", srt},
+		{"", []byte(srt), "subtitle.srt", srt},
+		{"", []byte(vtt), "subtitle.vtt", vtt},
+		{"download", []byte(ass), "download.ass", ass},
+		{"movie.7z", sevenZip, "dir/movie.srt", srt},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			a, err := NewReader(bytes.NewReader(test.data), int64(len(test.data)), test.name, ReaderOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := a.Extract(dir, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, ok := res[test.entry]
+			if !ok || r.Path == "" {
+				t.Fatalf("expected %s to be extracted, got %+v", test.entry, res)
+			}
+			b, err := os.ReadFile(r.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != test.contents {
+				t.Errorf("unexpected contents %q", b)
+			}
+			if s, ok := a.(*SingleArchive); ok && s.gz {
+				if s.size != int64(len(test.contents)) {
+					t.Errorf("expected the decompressed size to be cached, got %d", s.size)
+				}
+				if list, err := a.Entries(); err != nil || list[0].Size != s.size {
+					t.Errorf("unexpected entries %+v %v", list, err)
+				}
+			}
+		})
+	}
+
+	_, err = NewReader(bytes.NewReader([]byte{0, 1, 2, 3}), 4, "x.bin", ReaderOptions{})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+
+	subtitles := map[string]string{
+		srt: ".srt",
+		"WEBVTT\n\n00:01.000 --> 00:02.000\nHi\n":   ".vtt",
+		"\xef\xbb\xbf[Script Info]\r\nTitle: x\r\n": ".ass",
+		"<SAMI><BODY>": ".smi",
+		"{1}{25}Hi\n":  ".sub",
+		"\xff\xfe1\x00\n\x000\x00:\x000\x00:\x000\x00,\x000\x00 \x00-\x00-\x00>\x00": ".srt",
+		"<!DOCTYPE html><html><body>" + srt:                                          "",
+		"\n<html><head><title>Captcha</title>":                                       "",
+		"Too many requests, try again later.":                                        "",
+	}
+	for head, ext := range subtitles {
+		if got := subtitleExt([]byte(head)); got != ext {
+			t.Errorf("%q: expected %q, got %q", head, ext, got)
+		}
+	}
+}
+
+func TestExtractNested(t *testing.T) {
+	ep01 := zipBytes(t, map[string]string{"ep01.srt": srt})
+	ep02 := gz(t, "ep02.srt", []byte(srt))
+	pack := map[string]string{
+		"ep01.zip":    string(ep01),
+		"ep02.srt.gz": string(ep02),
+		"notes.txt":   "notes",
+	}
+
+	dir := t.TempDir()
+	res, err := testZip(t, pack).Extract(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["ep01.zip"].Path == "" || len(res) != 3 {
+		t.Errorf("depth 0 should extract nested archives as is, got %+v", res)
+	}
+
+	dir = t.TempDir()
+	filter := func(n string) bool { return filepath.Ext(n) == ".srt" }
+	res, err = testZip(t, pack).Extract(dir, Options{Filter: filter, Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"ep01.zip/ep01.srt", "ep02.srt.gz/ep02.srt"} {
+		if res[key].Path == "" {
+			t.Errorf("expected %s to be extracted, got %+v", key, res)
+		}
+	}
+	if _, ok := res["ep01.zip"]; ok {
+		t.Error("nested archive itself should not be listed")
+	}
+
+	res, err = testZip(t, pack).Extract(t.TempDir(), Options{Depth: 1, MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(res["ep01.zip"].Err, ErrBudget) {
+		t.Errorf("expected ErrBudget, got %+v", res["ep01.zip"])
+	}
+}
+
+func TestEntriesOpen(t *testing.T) {
+	archives := map[string][]byte{
+		"zip":    zipBytes(t, map[string]string{"movie.srt": srt}),
+		"tar.gz": gz(t, "", testTar(t, "movie.srt", srt)),
+		"gz":     gz(t, "movie.srt", []byte(srt)),
+	}
+
+	for name, data := range archives {
+		t.Run(name, func(t *testing.T) {
+			a, err := NewReader(bytes.NewReader(data), int64(len(data)), "", ReaderOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			list, err := a.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 || list[0].Name != "movie.srt" || list[0].Size != int64(len(srt)) {
+				t.Fatalf("unexpected entries %+v", list)
+			}
+
+			for i := 0; i < 2; i++ {
+				rc, err := a.Open("movie.srt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != srt {
+					t.Errorf("unexpected contents %q", b)
+				}
+			}
+
+			if _, err := a.Open("nope.srt"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("expected fs.ErrNotExist, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewReaderSpill(t *testing.T) {
+	data := zipBytes(t, map[string]string{"movie.srt": srt})
+	tmp := t.TempDir()
+	opts := ReaderOptions{SpillSize: 16, TempDir: tmp}
+
+	for _, size := range []int64{int64(len(data)), -1} {
+		a, err := NewReader(bytes.NewReader(data), size, "", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list, _ := os.ReadDir(tmp); len(list) != 1 {
+			t.Errorf("expected a spill file, got %d files", len(list))
+		}
+		if list, err := a.Entries(); err != nil || len(list) != 1 {
+			t.Errorf("unexpected entries %+v %v", list, err)
+		}
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ := os.ReadDir(tmp); len(list) != 0 {
+			t.Errorf("spill file not removed")
+		}
+	}
+
+	opts.MaxSize = int64(len(data)) - 1
+	for _, size := range []int64{int64(len(data)), -1} {
+		_, err := NewReader(bytes.NewReader(data), size, "", opts)
+		if !errors.Is(err, ErrTooLarge) {
+			t.Errorf("expected ErrTooLarge, got %v", err)
+		}
+	}
+	if list, _ := os.ReadDir(tmp); len(list) != 0 {
+		t.Errorf("spill file not removed")
+	}
+}
+
+func TestExtractKeepExt(t *testing.T) {
+	dir := t.TempDir()
+	a := testZip(t, map[string]string{
+		"Movie.IDX": "idx",
+		"Movie.SUB": "sub",
+		"other.srt": srt,
+	})
+
+	filter := func(n string) bool { return strings.ToLower(filepath.Ext(n)) != ".srt" }
+	res, err := a.Extract(filepath.Join(dir, "film"), Options{Filter: filter, KeepExt: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["Movie.IDX"].Path != filepath.Join(dir, "film.idx") ||
+		res["Movie.SUB"].Path != filepath.Join(dir, "film.sub") {
+		t.Errorf("expected idx/sub pair to be extracted together, got %+v", res)
+	}
+
+	dir = t.TempDir()
+	res, err = testZip(t, map[string]string{"a.ass": "ass", "b.ass": "ass"}).
+		Extract(filepath.Join(dir, "film"), Options{KeepExt: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 || entries[0].Name() != "film.ass" {
+		t.Errorf("expected a single film.ass, got %+v", res)
+	}
+}
+
+type rarFile struct {
+	name string
+	// data is stored as is, size and crc are those of the whole file for
+	// files split over multiple volumes.
+	data  string
+	size  int
+	crc   uint32
+	flags uint16
+}
+
+// rarBuild builds a rar 4 archive of stored files.
+func rarBuild(main, end uint16, files ...rarFile) []byte {
+	block := func(typ byte, flags uint16, body []byte) []byte {
+		h := make([]byte, 7, 7+len(body))
+		h[2] = typ
+		binary.LittleEndian.PutUint16(h[3:], flags)
+		binary.LittleEndian.PutUint16(h[5:], uint16(7+len(body)))
+		h = append(h, body...)
+		binary.LittleEndian.PutUint16(h, uint16(crc32.ChecksumIEEE(h[2:])))
+		return h
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.Write(magicRar)
+	buf.WriteByte(0)
+	buf.Write(block(0x73, main, make([]byte, 6)))
+	for _, f := range files {
+		body := make([]byte, 25, 25+len(f.name)+8)
+		binary.LittleEndian.PutUint32(body[0:], uint32(len(f.data)))
+		binary.LittleEndian.PutUint32(body[4:], uint32(f.size))
+		body[8] = 3
+		binary.LittleEndian.PutUint32(body[9:], f.crc)
+		body[17], body[18] = 20, 0x30
+		binary.LittleEndian.PutUint16(body[19:], uint16(len(f.name)))
+		body = append(body, f.name...)
+		if f.flags&0x0400 != 0 {
+			body = append(body, make([]byte, 8)...)
+		}
+		buf.Write(block(0x74, 0x8000|f.flags, body))
+		buf.WriteString(f.data)
+	}
+	buf.Write(block(0x7b, 0x4000|end, nil))
+	return buf.Bytes()
+}
+
+// rarBytes builds a rar archive, flags are added to every file header.
+// Encrypted files get a salt but their data is not actually encrypted, so
+// any password is wrong.
+func rarBytes(t *testing.T, files map[string]string, flags uint16) []byte {
+	t.Helper()
+	list := make([]rarFile, 0, len(files))
+	for name, data := range files {
+		f := rarFile{name, data, len(data), crc32.ChecksumIEEE([]byte(data)), flags}
+		if flags&0x0004 != 0 {
+			f.flags |= 0x0400
+			f.data += strings.Repeat("\x00", 15-(len(data)+15)%16)
+		}
+		list = append(list, f)
+	}
+	return rarBuild(0, 0, list...)
+}
+
+// rarVolumes splits a single file over n volumes.
+func rarVolumes(t *testing.T, name, data string, n int) [][]byte {
+	t.Helper()
+	vols := make([][]byte, n)
+	size := (len(data) + n - 1) / n
+	crc := crc32.ChecksumIEEE([]byte(data))
+	for i := range vols {
+		var flags, end uint16
+		if i != 0 {
+			flags |= 0x0001
+		}
+		if i != n-1 {
+			flags |= 0x0002
+			end = 0x0001
+		}
+		part := data[i*size:]
+		if len(part) > size {
+			part = part[:size]
+		}
+		vols[i] = rarBuild(0x0001|0x0010, end, rarFile{name, part, len(data), crc, flags})
+	}
+	return vols
+}
+
+func TestEncrypted(t *testing.T) {
+	plain := rarBytes(t, map[string]string{"movie.srt": srt}, 0)
+	a, err := NewReader(bytes.NewReader(plain), int64(len(plain)), "plain.rar", ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, err := a.Entries(); err != nil || len(list) != 1 || list[0].Name != "movie.srt" {
+		t.Errorf("unexpected entries %+v %v", list, err)
+	}
+
+	enc := rarBytes(t, map[string]string{"movie.srt": srt}, 0x0004)
+	_, err = NewReader(bytes.NewReader(enc), int64(len(enc)), "enc.rar", ReaderOptions{})
+	if !errors.Is(err, ErrEncrypted) {
+		t.Errorf("expected ErrEncrypted, got %v", err)
+	}
+
+	var asked int
+	_, err = NewReader(bytes.NewReader(enc), int64(len(enc)), "enc.rar", ReaderOptions{
+		PasswordFunc: func(name string) (string, error) {
+			asked++
+			if name != "enc.rar" {
+				t.Errorf("unexpected name %q", name)
+			}
+			return "wrong", nil
+		},
+	})
+	if !errors.Is(err, ErrEncrypted) || asked != maxPasswordAttempts {
+		t.Errorf("expected ErrEncrypted after %d attempts, got %v after %d", maxPasswordAttempts, err, asked)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	w := zip.NewWriter(buf)
+	if _, err := w.CreateHeader(&zip.FileHeader{Name: "locked.srt", Flags: 0x1}); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := w.Create("open.srt"); err != nil {
+		t.Fatal(err)
+	} else {
+		f.Write([]byte(srt))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err = NewReader(buf, int64(buf.Len()), "enc.zip", ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := a.Extract(t.TempDir(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(res["locked.srt"].Err, ErrEncrypted) || res["open.srt"].Path == "" {
+		t.Errorf("expected only locked.srt to be skipped, got %+v", res)
+	}
+}
+
+// rar5Block builds a rar 5 block header, the crc is not checked by rarScan.
+func rar5Block(fields ...uint64) []byte {
+	h := make([]byte, binary.MaxVarintLen64*len(fields))
+	var n int
+	for _, f := range fields {
+		n += binary.PutUvarint(h[n:], f)
+	}
+	b := make([]byte, 4+binary.MaxVarintLen64)
+	return append(b[:4+binary.PutUvarint(b[4:], uint64(n))], h[:n]...)
+}
+
+func TestRarScanHostile(t *testing.T) {
+	huge := uint64(1<<64 - 17)
+	rar5 := func(blocks ...[]byte) []byte {
+		return append(append([]byte{}, magicRar5...), bytes.Join(blocks, nil)...)
+	}
+	// type, flags, extra size, data size, then the extra area: a record
+	// size and type.
+	extra := rar5Block(2, 0x0001|0x0002, 2, 0, huge, 1)
+	// The packed size of the first file header follows the 7 byte marker,
+	// the 13 byte main header and the 7 byte file header prefix.
+	rar4 := rarBytes(t, map[string]string{"a.srt": srt}, 0)
+	binary.LittleEndian.PutUint32(rar4[27:], 0xffffffff)
+	rar4Header := func(b ...byte) []byte { return append(append([]byte{}, magicRar...), b...) }
+	tests := map[string][]byte{
+		"rar5 data size":   rar5(rar5Block(2, 0x0002, huge), rar5Block(5, 0)),
+		"rar5 header size": append(rar5(), 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01),
+		"rar5 record size": rar5(extra),
+		"rar5 truncated":   rar5(rar5Block(2, 0x0002, 100)[:6]),
+		"rar4 data size":   rar4,
+		"rar4 header size": rar4Header(0, 0, 0, 0x74, 0, 0x80, 0xff, 0xff),
+		"rar4 short":       rar4Header(0, 0, 0, 0x73, 0, 0, 3, 0),
+		"rar4 truncated":   rarBytes(t, map[string]string{"a.srt": srt}, 0)[:30],
+	}
+	for name, data := range tests {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s: panic: %v", name, r)
+				}
+			}()
+			rarScan(bytes.NewReader(data), int64(len(data)))
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: rarScan does not terminate", name)
+		}
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	vols := rarVolumes(t, "movie.srt", srt, 3)
+
+	res, err := testZip(t, map[string]string{
+		"movie.part1.rar": string(vols[0]),
+		"movie.part2.rar": string(vols[1]),
+		"movie.part3.rar": string(vols[2]),
+	}).Extract(t.TempDir(), Options{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := res["movie.part1.rar/movie.srt"]
+	if r.Path == "" || len(res) != 1 {
+		t.Fatalf("expected movie.srt to be extracted from all volumes, got %+v", res)
+	}
+	if b, _ := os.ReadFile(r.Path); string(b) != srt {
+		t.Errorf("unexpected contents %q", b)
+	}
+
+	res, err = testZip(t, map[string]string{
+		"movie.part1.rar": string(vols[0]),
+		"movie.part3.rar": string(vols[2]),
+	}).Extract(t.TempDir(), Options{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verr *VolumeError
+	if !errors.As(res["movie.part1.rar"].Err, &verr) ||
+		len(verr.Missing) != 1 || verr.Missing[0] != "movie.part2.rar" {
+		t.Errorf("expected movie.part2.rar to be missing, got %+v", res)
+	}
+
+	big := strings.Repeat(srt, 1<<16/len(srt)+1)
+	dir := t.TempDir()
+	for i, v := range rarVolumes(t, "movie.srt", big, 3) {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("movie.part%d.rar", i+1)), v, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rc, err := (&RarArchive{path: filepath.Join(dir, "movie.part1.rar")}).Open("movie.srt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(rc); err != nil || string(b) != big {
+		t.Errorf("unexpected contents of %d bytes %v", len(b), err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Error(err)
+	}
+
+	_, err = NewReader(bytes.NewReader(vols[0]), int64(len(vols[0])), "movie.part1.rar", ReaderOptions{})
+	if !errors.Is(err, ErrMissingVolume) || !strings.Contains(err.Error(), "movie.part2.rar") {
+		t.Errorf("expected ErrMissingVolume, got %v", err)
+	}
+}
+
+func TestExtractPolicy(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		existing string
+		path     string
+		contents string
+	}{
+		{Skip, "old", "", "old"},
+		{Overwrite, "old", "movie.srt", srt},
+		{Number, "old", "movie.1.srt", "old"},
+		{Update, strings.Repeat("old", 100), "", strings.Repeat("old", 100)},
+		{Update, "old", "movie.srt", srt},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			fn := filepath.Join(dir, "movie.srt")
+			if err := os.WriteFile(fn, []byte(test.existing), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := testZip(t, map[string]string{"movie.srt": srt}).
+				Extract(dir, Options{Policy: test.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := res["movie.srt"]
+			if !r.Existed || r.Policy != test.policy {
+				t.Errorf("expected %s to be applied, got %+v", test.policy, r)
+			}
+			exp := test.path
+			if exp != "" {
+				exp = filepath.Join(dir, exp)
+			}
+			if r.Path != exp {
+				t.Errorf("expected path %q, got %q", exp, r.Path)
+			}
+			if b, _ := os.ReadFile(fn); string(b) != test.contents {
+				t.Errorf("unexpected contents %q", b)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "movie.srt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	const n = 8
+	paths := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := testZip(t, map[string]string{"movie.srt": srt}).Extract(dir, Options{Policy: Number})
+			if err != nil {
+				t.Error(err)
+			}
+			paths <- res["movie.srt"].Path
+		}()
+	}
+	wg.Wait()
+	close(paths)
+	seen := make(map[string]struct{}, n)
+	for p := range paths {
+		seen[p] = struct{}{}
+	}
+	if list, _ := os.ReadDir(dir); len(seen) != n || len(list) != n+1 {
+		t.Errorf("expected %d numbered files, got %d paths and %d files", n, len(seen), len(list))
+	}
+
+	if p, err := ParsePolicy("Number"); err != nil || p != Number {
+		t.Errorf("expected Number, got %s %v", p, err)
+	}
+}
+
+func TestExtractFile(t *testing.T) {
+	dir := t.TempDir()
+	ref, err := os.Create(filepath.Join(dir, "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Close()
+	stat, _ := os.Stat(ref.Name())
+	exp := stat.Mode().Perm()
+
+	res, err := testZip(t, map[string]string{"movie.srt": srt}).Extract(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := res["movie.srt"].Path
+	if stat, err := os.Stat(path); err != nil || stat.Mode().Perm() != exp {
+		t.Errorf("expected %v like os.Create, got %v %v", exp, stat.Mode(), err)
+	}
+	if stat, err := os.Stat(path); err != nil || time.Since(stat.ModTime()) > time.Minute {
+		t.Errorf("expected the time of extraction as mtime, got %v %v", stat.ModTime(), err)
+	}
+
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	_, err = testZip(t, map[string]string{"movie.srt": srt}).Extract(dir, Options{Policy: Overwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := os.Stat(path); err != nil || stat.Mode().Perm() != 0640 {
+		t.Errorf("expected the mode of the overwritten file to be kept, got %v %v", stat.Mode(), err)
+	}
+}
@@ -0,0 +1,523 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/frizinak/subscene/internal/tempfile"
+)
+
+type Filter func(name string) bool
+
+// Options configure Archive.Extract.
+type Options struct {
+	// Filter decides which files are extracted by their base name.
+	// nil extracts everything.
+	Filter Filter
+	// Depth is the number of levels of nested archives that are descended
+	// into, 0 treats nested archives as regular files.
+	Depth int
+	// MaxSize is the total number of bytes that may be buffered for nested
+	// archives, defaults to DefaultMaxNestedSize.
+	MaxSize int64
+	// KeepExt treats a dest that is not a directory as a filename without
+	// extension, the extension of the extracted entry is appended to it.
+	// This also allows files that belong together (VobSub .idx and .sub)
+	// to be extracted side by side.
+	KeepExt bool
+	// Transform, if set, is applied to the contents of every extracted
+	// file. It returns the new contents and the name of the encoding the
+	// original was detected as, which is stored in Result.Encoding.
+	Transform Transform
+	// Policy decides what happens when a file already exists,
+	// defaults to Skip.
+	Policy Policy
+}
+
+// Policy decides what happens to files that already exist.
+type Policy int
+
+const (
+	// Skip leaves existing files alone.
+	Skip Policy = iota
+	// Overwrite replaces existing files.
+	Overwrite
+	// Number keeps both, the new file gets a numbered suffix:
+	// movie.1.srt, movie.2.srt, ….
+	Number
+	// Update replaces existing files if the new one is larger or was
+	// modified more recently.
+	Update
+)
+
+var policies = map[Policy]string{
+	Skip:      "skip",
+	Overwrite: "overwrite",
+	Number:    "number",
+	Update:    "update",
+}
+
+func (p Policy) String() string {
+	if s, ok := policies[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("policy %d", int(p))
+}
+
+// ParsePolicy is the inverse of Policy.String.
+func ParsePolicy(s string) (Policy, error) {
+	for p, str := range policies {
+		if strings.EqualFold(s, str) {
+			return p, nil
+		}
+	}
+	return Skip, fmt.Errorf("unknown overwrite policy %q", s)
+}
+
+type Transform func(name string, r io.Reader) (io.Reader, string, error)
+
+const DefaultMaxNestedSize = 1024 * 1024 * 80
+
+// Result describes what happened to a single archive entry.
+type Result struct {
+	// Path is the file the entry was written to, empty if it was skipped
+	// or rejected.
+	Path string
+	// Err is the reason the entry was rejected.
+	Err error
+	// Encoding is the source encoding reported by Options.Transform.
+	Encoding string
+	// Existed is set if the destination already existed, in which case
+	// Policy is the Options.Policy that was applied to it.
+	Existed bool
+	Policy  Policy
+}
+
+var ErrBudget = errors.New("nested archive exceeds the size budget")
+
+var nestedExts = map[string]struct{}{
+	".zip": {}, ".rar": {}, ".7z": {}, ".tar": {}, ".tgz": {}, ".gz": {},
+}
+
+// companions maps extensions of files that are only usable together.
+var companions = map[string]string{
+	".idx": ".sub",
+	".sub": ".idx",
+}
+
+func stem(name string) string { return strings.TrimSuffix(name, filepath.Ext(name)) }
+
+func isNested(name string) bool {
+	_, ok := nestedExts[strings.ToLower(filepath.Ext(name))]
+	return ok || isVolumeExt(name)
+}
+
+type extractor struct {
+	files     map[string]Result
+	dest      *dest
+	filter    Filter
+	transform Transform
+	budget    int64
+	opts      ReaderOptions
+
+	// volumes are the rar volumes found while walking the current
+	// archive, keyed by volumeName.set.
+	volumes map[string][]*volume
+
+	// companion is set in single file mode after extracting a file that
+	// has a companion that should be extracted as well.
+	companion string
+}
+
+func extractAll(a walker, dest string, opts Options) (map[string]Result, error) {
+	if opts.Filter == nil {
+		opts.Filter = func(string) bool { return true }
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxNestedSize
+	}
+
+	e := &extractor{
+		files:     make(map[string]Result),
+		dest:      newDest(dest, opts.KeepExt, opts.Policy),
+		filter:    opts.Filter,
+		transform: opts.Transform,
+		budget:    opts.MaxSize,
+		opts:      a.readerOptions(),
+	}
+
+	_, err := e.walk(a, "", opts.Depth)
+	return e.files, err
+}
+
+func (e *extractor) walk(a walker, prefix string, depth int) (stop bool, err error) {
+	parent := e.volumes
+	e.volumes = make(map[string][]*volume)
+	err = a.walk(func(entry Entry, open opener) (bool, error) {
+		stop, err = e.entry(prefix+entry.Name, entry, open, depth)
+		return stop, err
+	})
+
+	volumes := e.volumes
+	e.volumes = parent
+	if stop || err != nil {
+		return stop, err
+	}
+
+	sets := make([]string, 0, len(volumes))
+	for set := range volumes {
+		sets = append(sets, set)
+	}
+	sort.Strings(sets)
+	for _, set := range sets {
+		if stop, err = e.assemble(volumes[set], depth); stop || err != nil {
+			return stop, err
+		}
+	}
+
+	return false, nil
+}
+
+// entry handles a single entry, stop is true when no further entries
+// should be extracted.
+func (e *extractor) entry(key string, entry Entry, open opener, depth int) (stop bool, err error) {
+	clean, err := cleanName(entry.Name)
+	if err != nil {
+		e.files[key] = Result{Err: err}
+		return false, nil
+	}
+
+	if depth > 0 && isNested(clean) {
+		return e.nested(key, clean, open, depth)
+	}
+
+	e.files[key] = Result{}
+	if !e.filter(clean) {
+		return false, nil
+	}
+	if e.companion != "" && !strings.EqualFold(clean, e.companion) {
+		return false, nil
+	}
+
+	rc, err := open()
+	if errors.Is(err, ErrEncrypted) {
+		e.files[key] = Result{Err: err}
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	var enc string
+	if e.transform != nil {
+		if r, enc, err = e.transform(clean, rc); err != nil {
+			e.files[key] = Result{Err: err}
+			return false, nil
+		}
+	}
+
+	res, err := e.dest.read(r, clean, entry.Modified)
+	if errors.Is(err, ErrSymlink) {
+		e.files[key] = Result{Err: err}
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+
+	res.Encoding = enc
+	e.files[key] = res
+	if res.Path == "" {
+		return false, nil
+	}
+
+	if !e.dest.single() {
+		return false, nil
+	}
+	if e.companion == "" && e.dest.keepExt {
+		if ext, ok := companions[strings.ToLower(filepath.Ext(clean))]; ok {
+			e.companion = stem(clean) + ext
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (e *extractor) nested(key, name string, open opener, depth int) (bool, error) {
+	r, err := open()
+	if errors.Is(err, ErrEncrypted) {
+		e.files[key] = Result{Err: err}
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	defer r.Close()
+
+	buf, err := io.ReadAll(io.LimitReader(r, e.budget+1))
+	if err != nil {
+		return true, err
+	}
+	if int64(len(buf)) > e.budget {
+		e.files[key] = Result{Err: ErrBudget}
+		return false, nil
+	}
+	e.budget -= int64(len(buf))
+
+	if v, ok := parseVolume(name); ok && bytes.HasPrefix(buf, magicRar) {
+		info, err := rarScan(bytes.NewReader(buf), int64(len(buf)))
+		if err == nil && info.volume {
+			set := v.set()
+			e.volumes[set] = append(e.volumes[set], &volume{key, name, v, info, buf})
+			return false, nil
+		}
+	}
+
+	a, err := newArchive(io.NewSectionReader(bytes.NewReader(buf), 0, int64(len(buf))), name, common{opts: e.opts})
+	if err != nil {
+		e.files[key] = Result{Err: err}
+		return false, nil
+	}
+
+	return e.walk(a.(walker), key+"/", depth-1)
+}
+
+type volume struct {
+	key  string
+	file string
+	name volumeName
+	info rarInfo
+	data []byte
+}
+
+// assemble extracts a multi-volume rar archive of which all volumes were
+// found in the same parent archive. Results are keyed by the first volume.
+func (e *extractor) assemble(set []*volume, depth int) (bool, error) {
+	sort.Slice(set, func(i, j int) bool { return set[i].name.n < set[j].name.n })
+	first, last := set[0], set[len(set)-1]
+
+	var missing []string
+	have := make(map[int]struct{}, len(set))
+	for _, v := range set {
+		have[v.name.n] = struct{}{}
+	}
+	for n := 0; n <= last.name.n; n++ {
+		if _, ok := have[n]; !ok {
+			missing = append(missing, first.name.nth(n))
+		}
+	}
+	if last.info.splitAfter {
+		missing = append(missing, first.name.nth(last.name.n+1))
+	}
+	if len(missing) != 0 {
+		e.files[first.key] = Result{Err: &VolumeError{first.file, missing}}
+		return false, nil
+	}
+
+	dir, err := os.MkdirTemp(e.opts.TempDir, "subscene-*.volumes")
+	if err != nil {
+		return true, err
+	}
+	defer os.RemoveAll(dir)
+
+	for _, v := range set {
+		if err := os.WriteFile(filepath.Join(dir, v.file), v.data, 0600); err != nil {
+			return true, err
+		}
+	}
+
+	a := &RarArchive{common: common{opts: e.opts}, path: filepath.Join(dir, first.file)}
+	if _, err := a.unlock(first.file, first.info.encrypted); err != nil {
+		e.files[first.key] = Result{Err: err}
+		return false, nil
+	}
+
+	return e.walk(a, first.key+"/", depth-1)
+}
+
+var ErrSymlink = errors.New("refusing to write through a symlink")
+
+// NameError is the reason an entry with an unsafe name was rejected.
+type NameError struct {
+	Name   string
+	Reason string
+}
+
+func (n *NameError) Error() string {
+	return fmt.Sprintf("unsafe entry name %q: %s", n.Name, n.Reason)
+}
+
+const maxNameLength = 255
+
+var reservedNames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {},
+	"COM0": {}, "COM1": {}, "COM2": {}, "COM3": {}, "COM4": {},
+	"COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"COM¹": {}, "COM²": {}, "COM³": {},
+	"LPT0": {}, "LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {},
+	"LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+	"LPT¹": {}, "LPT²": {}, "LPT³": {},
+}
+
+// invalidChar reports whether Windows refuses r in a file name.
+func invalidChar(r rune) bool {
+	return r < 0x20 || strings.ContainsRune(`<>:"|?*`, r)
+}
+
+// cleanName reduces an entry name to its base name and makes it safe to
+// create on any common filesystem: characters Windows refuses are
+// replaced with an underscore and trailing dots and spaces, which Windows
+// silently drops, are trimmed. Names that are empty, too long or a
+// reserved device name (with or without an extension) are rejected.
+func cleanName(name string) (string, error) {
+	if strings.IndexByte(name, 0) != -1 {
+		return "", &NameError{name, "contains a NUL byte"}
+	}
+
+	clean := filepath.Base(filepath.Clean(strings.ReplaceAll(name, "\\", "/")))
+	if clean == "." || clean == ".." || clean == "/" {
+		clean = ""
+	}
+	clean = strings.TrimRight(strings.Map(func(r rune) rune {
+		if invalidChar(r) {
+			return '_'
+		}
+		return r
+	}, clean), ". ")
+	if clean == "" {
+		return "", &NameError{name, "empty name"}
+	}
+	if len(clean) > maxNameLength {
+		return "", &NameError{name, "name too long"}
+	}
+
+	stem := strings.ToUpper(strings.SplitN(clean, ".", 2)[0])
+	if _, ok := reservedNames[strings.TrimRight(stem, " ")]; ok {
+		return "", &NameError{name, "reserved device name"}
+	}
+
+	return clean, nil
+}
+
+type dest struct {
+	d       string
+	dir     bool
+	keepExt bool
+	policy  Policy
+}
+
+func newDest(path string, keepExt bool, policy Policy) *dest {
+	stat, _ := os.Stat(path)
+	isDir := stat != nil && stat.IsDir()
+	return &dest{path, isDir, keepExt, policy}
+}
+
+// file returns the path name should be written to and the file that
+// already exists there, if any.
+func (d *dest) file(name string) (real string, stat os.FileInfo, err error) {
+	real = d.d
+	switch {
+	case d.dir:
+		real = filepath.Join(d.d, name)
+	case d.keepExt:
+		real = d.d + strings.ToLower(filepath.Ext(name))
+	}
+
+	stat, _ = os.Lstat(real)
+	if stat != nil && stat.Mode()&os.ModeSymlink != 0 {
+		return real, stat, ErrSymlink
+	}
+
+	return real, stat, nil
+}
+
+// numbered claims the first movie.N.srt for real that does not exist by
+// creating it, so concurrent extractions never pick the same name.
+func numbered(real string) (string, error) {
+	ext := filepath.Ext(real)
+	stem := strings.TrimSuffix(real, ext)
+	for i := 1; ; i++ {
+		fn := fmt.Sprintf("%s.%d%s", stem, i, ext)
+		f, err := os.OpenFile(fn, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return fn, f.Close()
+	}
+}
+
+// WriteFile writes r to path like Extract writes entries, existing files are
+// handled according to policy.
+func WriteFile(path string, r io.Reader, policy Policy) (Result, error) {
+	return (&dest{d: path, policy: policy}).read(r, filepath.Base(path), time.Time{})
+}
+
+func (d *dest) single() bool { return !d.dir }
+
+// read writes r to a temporary file next to the destination and renames
+// it into place, existing files are handled according to d.policy.
+// Symlinks are never followed. mod is the modification time of the entry,
+// it is only used for Update, the file keeps the time it was written at.
+// The returned Result has Path set if the file was written.
+func (d *dest) read(r io.Reader, name string, mod time.Time) (Result, error) {
+	real, stat, err := d.file(name)
+	res := Result{Existed: stat != nil}
+	if res.Existed {
+		res.Policy = d.policy
+	}
+	if err != nil || (res.Existed && d.policy == Skip) {
+		return res, err
+	}
+	f, err := tempfile.Create(real)
+	if err != nil {
+		return res, err
+	}
+	tmp := f.Name()
+	n, err := io.Copy(f, r)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return res, err
+	}
+
+	if err = f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return res, err
+	}
+
+	if res.Existed && d.policy == Update && n <= stat.Size() && !mod.After(stat.ModTime()) {
+		return res, os.Remove(tmp)
+	}
+
+	claimed := res.Existed && d.policy == Number
+	if claimed {
+		if real, err = numbered(real); err != nil {
+			_ = os.Remove(tmp)
+			return res, err
+		}
+	}
+
+	if err = os.Rename(tmp, real); err != nil {
+		_ = os.Remove(tmp)
+		if claimed {
+			_ = os.Remove(real)
+		}
+		return res, err
+	}
+
+	res.Path = real
+	return res, nil
+}
@@ -0,0 +1,305 @@
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var magicRar5 = []byte("Rar!\x1a\x07\x01\x00")
+
+// rarInfo is what rardecode does not tell us about a rar archive before
+// it fails halfway through.
+type rarInfo struct {
+	// encrypted is set when the headers or any of the files are encrypted.
+	// rardecode happily decrypts with the wrong password and only fails
+	// once the garbage it produced does not decompress.
+	encrypted bool
+	// volume is set for any volume of a multi-volume archive.
+	volume bool
+	// splitBefore and splitAfter are set when the first file started in
+	// a previous volume or the last file continues in the next one.
+	splitBefore bool
+	splitAfter  bool
+}
+
+func (i rarInfo) incomplete() bool { return i.volume && (i.splitBefore || i.splitAfter) }
+
+// rarScan walks the block headers of a rar archive.
+func rarScan(r io.ReaderAt, size int64) (rarInfo, error) {
+	sig := make([]byte, len(magicRar5))
+	if _, err := r.ReadAt(sig, 0); err != nil && err != io.EOF {
+		return rarInfo{}, err
+	}
+	if string(sig) == string(magicRar5) {
+		return rar5Scan(r, size)
+	}
+	return rar4Scan(r, size)
+}
+
+func rar4Scan(r io.ReaderAt, size int64) (rarInfo, error) {
+	const (
+		typeMain = 0x73
+		typeFile = 0x74
+		typeEnd  = 0x7b
+
+		flagLong          = 0x8000
+		flagMainVolume    = 0x0001
+		flagMainEncrypted = 0x0080
+		flagSplitBefore   = 0x0001
+		flagSplitAfter    = 0x0002
+		flagFileEncrypted = 0x0004
+	)
+
+	var info rarInfo
+	first := true
+	h := make([]byte, 11)
+	for pos := int64(0); pos < size; {
+		n, err := r.ReadAt(h, pos)
+		if n < 7 {
+			if err == io.EOF {
+				err = nil
+			}
+			return info, err
+		}
+
+		typ := h[2]
+		flags := binary.LittleEndian.Uint16(h[3:])
+		hsize := int64(binary.LittleEndian.Uint16(h[5:]))
+		if hsize < 7 || hsize > size-pos {
+			return info, nil
+		}
+
+		switch typ {
+		case typeMain:
+			info.volume = flags&flagMainVolume != 0
+			if flags&flagMainEncrypted != 0 {
+				info.encrypted = true
+				return info, nil
+			}
+		case typeFile:
+			if first && flags&flagSplitBefore != 0 {
+				info.splitBefore = true
+			}
+			first = false
+			info.splitAfter = flags&flagSplitAfter != 0
+			info.encrypted = info.encrypted || flags&flagFileEncrypted != 0
+		case typeEnd:
+			return info, nil
+		}
+
+		pos += hsize
+		if flags&flagLong != 0 && n >= 11 {
+			data := int64(binary.LittleEndian.Uint32(h[7:]))
+			if data > size-pos {
+				return info, nil
+			}
+			pos += data
+		}
+	}
+
+	return info, nil
+}
+
+func vint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func rar5Scan(r io.ReaderAt, size int64) (rarInfo, error) {
+	const (
+		typeMain       = 1
+		typeFile       = 2
+		typeEncryption = 4
+		typeEnd        = 5
+
+		flagExtra       = 0x0001
+		flagData        = 0x0002
+		flagSplitBefore = 0x0008
+		flagSplitAfter  = 0x0010
+		flagMainVolume  = 0x0001
+
+		extraEncryption = 1
+	)
+
+	var info rarInfo
+	first := true
+	pre := make([]byte, 4+3)
+	for pos := int64(len(magicRar5)); pos < size; {
+		n, err := r.ReadAt(pre, pos)
+		if n < 5 {
+			if err == io.EOF {
+				err = nil
+			}
+			return info, err
+		}
+
+		// Sizes are untrusted uint64s, compare them before converting so
+		// they can neither overflow nor move pos backwards.
+		hsize, l := vint(pre[4:n])
+		if l == 0 || hsize == 0 || hsize > uint64(size-pos-4-int64(l)) {
+			return info, nil
+		}
+
+		h := make([]byte, hsize)
+		if _, err := r.ReadAt(h, pos+4+int64(l)); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return info, err
+		}
+
+		var o int
+		typ, l1 := vint(h)
+		flags, l2 := vint(h[l1:])
+		o = l1 + l2
+		var extra, data uint64
+		if flags&flagExtra != 0 {
+			v, l := vint(h[o:])
+			extra, o = v, o+l
+		}
+		if flags&flagData != 0 {
+			v, l := vint(h[o:])
+			data, o = v, o+l
+		}
+
+		switch typ {
+		case typeEncryption:
+			info.encrypted = true
+			return info, nil
+		case typeEnd:
+			return info, nil
+		case typeMain:
+			arcFlags, _ := vint(h[o:])
+			info.volume = arcFlags&flagMainVolume != 0
+		case typeFile:
+			if first && flags&flagSplitBefore != 0 {
+				info.splitBefore = true
+			}
+			first = false
+			info.splitAfter = flags&flagSplitAfter != 0
+
+			if extra > hsize {
+				return info, nil
+			}
+			for e := h[hsize-extra:]; len(e) != 0; {
+				rsize, l := vint(e)
+				if l == 0 || rsize == 0 || rsize > uint64(len(e)-l) {
+					break
+				}
+				if rtype, _ := vint(e[l:]); rtype == extraEncryption {
+					info.encrypted = true
+				}
+				e = e[l+int(rsize):]
+			}
+		}
+
+		pos += 4 + int64(l) + int64(hsize)
+		if data > uint64(size-pos) {
+			return info, nil
+		}
+		pos += int64(data)
+	}
+
+	return info, nil
+}
+
+// ErrMissingVolume is matched by a VolumeError.
+var ErrMissingVolume = errors.New("missing rar volume")
+
+// VolumeError is returned for a multi-volume rar archive of which not all
+// volumes are available.
+type VolumeError struct {
+	// Name is the name of the volume the error was encountered in.
+	Name string
+	// Missing are the names of the missing volumes, as far as they could
+	// be determined.
+	Missing []string
+}
+
+func (v *VolumeError) Error() string {
+	if len(v.Missing) == 0 {
+		return fmt.Sprintf("%s is part of a multi-volume rar archive with missing volumes", v.Name)
+	}
+	return fmt.Sprintf("%s is part of a multi-volume rar archive, missing %s", v.Name, strings.Join(v.Missing, ", "))
+}
+
+func (v *VolumeError) Is(err error) bool { return err == ErrMissingVolume }
+
+var (
+	rePartVolume = regexp.MustCompile(`(?i)^(.*)\.part(\d+)\.rar$`)
+	reOldVolume  = regexp.MustCompile(`(?i)^(.*)\.r(\d\d)$`)
+	reRar        = regexp.MustCompile(`(?i)^(.*)\.rar$`)
+)
+
+// volumeName is the name of a single volume of a multi-volume rar archive,
+// either name.part1.rar, name.part2.rar, … or name.rar, name.r00, ….
+type volumeName struct {
+	stem  string
+	part  bool
+	width int
+	// n is the 0 based index of the volume.
+	n int
+}
+
+func parseVolume(name string) (volumeName, bool) {
+	if m := rePartVolume.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return volumeName{m[1], true, len(m[2]), n - 1}, n > 0
+	}
+	if m := reOldVolume.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return volumeName{m[1], false, 2, n + 1}, true
+	}
+	if m := reRar.FindStringSubmatch(name); m != nil {
+		return volumeName{m[1], false, 2, 0}, true
+	}
+	return volumeName{}, false
+}
+
+// set identifies the archive the volume belongs to.
+func (v volumeName) set() string {
+	return fmt.Sprintf("%s/%t", strings.ToLower(v.stem), v.part)
+}
+
+// nth returns the name of the volume with index n in the same archive.
+func (v volumeName) nth(n int) string {
+	if v.part {
+		return fmt.Sprintf("%s.part%0*d.rar", v.stem, v.width, n+1)
+	}
+	if n == 0 {
+		return v.stem + ".rar"
+	}
+	return fmt.Sprintf("%s.r%02d", v.stem, n-1)
+}
+
+// isVolumeExt reports whether name has an extension only used by rar
+// volumes.
+func isVolumeExt(name string) bool { return reOldVolume.MatchString(name) }
+
+func volumeError(name string, info rarInfo) error {
+	err := &VolumeError{Name: name}
+	v, ok := parseVolume(name)
+	if !ok {
+		return err
+	}
+	if info.splitBefore {
+		for i := 0; i < v.n; i++ {
+			err.Missing = append(err.Missing, v.nth(i))
+		}
+	}
+	if info.splitAfter {
+		err.Missing = append(err.Missing, v.nth(v.n+1))
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+// Package charset detects the encoding of subtitle files and converts them
+// to UTF-8.
+package charset
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/frizinak/subscene/provider"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	utf16 "golang.org/x/text/encoding/unicode"
+)
+
+const (
+	UTF8    = "utf-8"
+	UTF8BOM = "utf-8-bom"
+	UTF16LE = "utf-16le"
+	UTF16BE = "utf-16be"
+)
+
+type candidate struct {
+	name   string
+	enc    encoding.Encoding
+	script *unicode.RangeTable
+}
+
+var (
+	windows1250 = candidate{"windows-1250", charmap.Windows1250, unicode.Latin}
+	windows1251 = candidate{"windows-1251", charmap.Windows1251, unicode.Cyrillic}
+	windows1252 = candidate{"windows-1252", charmap.Windows1252, unicode.Latin}
+	windows1253 = candidate{"windows-1253", charmap.Windows1253, unicode.Greek}
+	windows1254 = candidate{"windows-1254", charmap.Windows1254, unicode.Latin}
+	windows1255 = candidate{"windows-1255", charmap.Windows1255, unicode.Hebrew}
+	windows1256 = candidate{"windows-1256", charmap.Windows1256, unicode.Arabic}
+	windows1257 = candidate{"windows-1257", charmap.Windows1257, unicode.Latin}
+	windows1258 = candidate{"windows-1258", charmap.Windows1258, unicode.Latin}
+	windows874  = candidate{"windows-874", charmap.Windows874, unicode.Thai}
+	iso8859_1   = candidate{"iso-8859-1", charmap.ISO8859_1, unicode.Latin}
+	iso8859_2   = candidate{"iso-8859-2", charmap.ISO8859_2, unicode.Latin}
+	iso8859_4   = candidate{"iso-8859-4", charmap.ISO8859_4, unicode.Latin}
+	iso8859_5   = candidate{"iso-8859-5", charmap.ISO8859_5, unicode.Cyrillic}
+	iso8859_6   = candidate{"iso-8859-6", charmap.ISO8859_6, unicode.Arabic}
+	iso8859_7   = candidate{"iso-8859-7", charmap.ISO8859_7, unicode.Greek}
+	iso8859_8   = candidate{"iso-8859-8", charmap.ISO8859_8, unicode.Hebrew}
+	iso8859_9   = candidate{"iso-8859-9", charmap.ISO8859_9, unicode.Latin}
+	iso8859_13  = candidate{"iso-8859-13", charmap.ISO8859_13, unicode.Latin}
+	iso8859_15  = candidate{"iso-8859-15", charmap.ISO8859_15, unicode.Latin}
+	koi8r       = candidate{"koi8-r", charmap.KOI8R, unicode.Cyrillic}
+	cp866       = candidate{"cp866", charmap.CodePage866, unicode.Cyrillic}
+	gb18030     = candidate{"gb18030", simplifiedchinese.GB18030, unicode.Han}
+	big5        = candidate{"big5", traditionalchinese.Big5, unicode.Han}
+	shiftJIS    = candidate{"shift_jis", japanese.ShiftJIS, unicode.Han}
+	eucJP       = candidate{"euc-jp", japanese.EUCJP, unicode.Han}
+	eucKR       = candidate{"euc-kr", korean.EUCKR, unicode.Hangul}
+)
+
+var western = []candidate{windows1252, iso8859_15, iso8859_1}
+
+// languages lists the likely legacy encodings per language, most likely
+// first.
+var languages = map[provider.Language][]candidate{
+	provider.LangArabic:               {windows1256, iso8859_6},
+	provider.LangFarsi_persian:        {windows1256, iso8859_6},
+	provider.LangBig_5_code:           {big5, gb18030},
+	provider.LangChinese:              {gb18030, big5},
+	provider.LangCroatian:             {windows1250, iso8859_2},
+	provider.LangPolish:               {windows1250, iso8859_2},
+	provider.LangSlovenian:            {windows1250, iso8859_2},
+	provider.LangSerbian:              {windows1250, windows1251, iso8859_2, iso8859_5},
+	provider.LangRussian:              {windows1251, koi8r, iso8859_5, cp866},
+	provider.LangGreek:                {windows1253, iso8859_7},
+	provider.LangTurkish:              {windows1254, iso8859_9},
+	provider.LangHebrew:               {windows1255, iso8859_8},
+	provider.LangEstonian:             {windows1257, iso8859_13, iso8859_4},
+	provider.LangLatvian:              {windows1257, iso8859_13, iso8859_4},
+	provider.LangLithuanian:           {windows1257, iso8859_13, iso8859_4},
+	provider.LangVietnamese:           {windows1258},
+	provider.LangThai:                 {windows874},
+	provider.LangJapanese:             {shiftJIS, eucJP},
+	provider.LangKorean:               {eucKR},
+	provider.LangEnglish:              western,
+	provider.LangDutch:                western,
+	provider.LangDanish:               western,
+	provider.LangFinnish:              western,
+	provider.LangFrench:               western,
+	provider.LangGerman:               western,
+	provider.LangItalian:              western,
+	provider.LangNorwegian:            western,
+	provider.LangPortuguese:           western,
+	provider.LangBrazillianPortuguese: western,
+	provider.LangSpanish:              western,
+	provider.LangSwedish:              western,
+	provider.LangIndonesian:           western,
+	provider.LangMalay:                western,
+}
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16LE = []byte{0xff, 0xfe}
+	bomUTF16BE = []byte{0xfe, 0xff}
+)
+
+// Detect returns the name of the most likely encoding of b and the
+// encoding itself, nil for UTF-8. hint is the language the text is
+// expected to be in and decides between ambiguous single byte code pages,
+// it may be empty.
+func Detect(b []byte, hint provider.Language) (string, encoding.Encoding) {
+	switch {
+	case bytes.HasPrefix(b, bomUTF8):
+		return UTF8BOM, nil
+	case bytes.HasPrefix(b, bomUTF16LE):
+		return UTF16LE, utf16.UTF16(utf16.LittleEndian, utf16.ExpectBOM)
+	case bytes.HasPrefix(b, bomUTF16BE):
+		return UTF16BE, utf16.UTF16(utf16.BigEndian, utf16.ExpectBOM)
+	}
+
+	if le, ok := utf16NoBOM(b); ok {
+		if le {
+			return UTF16LE, utf16.UTF16(utf16.LittleEndian, utf16.IgnoreBOM)
+		}
+		return UTF16BE, utf16.UTF16(utf16.BigEndian, utf16.IgnoreBOM)
+	}
+
+	if utf8.Valid(b) {
+		return UTF8, nil
+	}
+
+	candidates, ok := languages[hint]
+	if !ok {
+		candidates = western
+	}
+
+	best, bestScore := candidates[0], 0
+	for i, c := range candidates {
+		s := score(b, c)
+		if i == 0 || s > bestScore {
+			best, bestScore = c, s
+		}
+	}
+
+	return best.name, best.enc
+}
+
+// utf16NoBOM guesses whether b is UTF-16 without a byte order mark from
+// the distribution of NUL bytes, which are common in UTF-16 encoded
+// latin text and absent in all other supported encodings.
+func utf16NoBOM(b []byte) (le bool, ok bool) {
+	n := len(b)
+	if n > 4096 {
+		n = 4096
+	}
+	if n < 4 {
+		return false, false
+	}
+
+	var even, odd int
+	for i := 0; i < n; i++ {
+		if b[i] != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			even++
+		} else {
+			odd++
+		}
+	}
+
+	half := n / 2
+	switch {
+	case odd > half/3 && even < odd/10:
+		return true, true
+	case even > half/3 && odd < even/10:
+		return false, true
+	}
+	return false, false
+}
+
+// score rates how plausible it is that b is encoded with c: letters in
+// the script c is used for count in favour, undecodable bytes and stray
+// control characters against.
+func score(b []byte, c candidate) int {
+	dec, err := c.enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return -len(b)
+	}
+
+	var s int
+	for _, r := range string(dec) {
+		switch {
+		case r < utf8.RuneSelf:
+		case r == utf8.RuneError:
+			s -= 10
+		case unicode.IsLetter(r) && unicode.Is(c.script, r):
+			s++
+			if unicode.IsLower(r) || !unicode.IsUpper(r) {
+				s++
+			}
+		case unicode.IsPunct(r), unicode.IsSymbol(r), unicode.IsSpace(r):
+		default:
+			s -= 2
+		}
+	}
+
+	return s
+}
+
+// ToUTF8 converts b to UTF-8 without a byte order mark and returns the
+// name of the encoding it was detected as. See Detect.
+func ToUTF8(b []byte, hint provider.Language) ([]byte, string, error) {
+	name, enc := Detect(b, hint)
+	if enc == nil {
+		return bytes.TrimPrefix(b, bomUTF8), name, nil
+	}
+
+	out, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return b, name, err
+	}
+
+	return bytes.TrimPrefix(out, bomUTF8), name, nil
+}
@@ -0,0 +1,68 @@
+package charset
+
+import (
+	"testing"
+
+	"github.com/frizinak/subscene/provider"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	utf16 "golang.org/x/text/encoding/unicode"
+)
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	t.Helper()
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestToUTF8(t *testing.T) {
+	const (
+		ru = "1\r\n00:00:01,000 --> 00:00:02,000\r\nПривет, как дела? Всё хорошо.\r\n"
+		el = "1\r\n00:00:01,000 --> 00:00:02,000\r\nΚαλημέρα, τι κάνεις;\r\n"
+		fr = "1\r\n00:00:01,000 --> 00:00:02,000\r\n“Ça va très bien”, répondit-il.\r\n"
+		zh = "1\r\n00:00:01,000 --> 00:00:02,000\r\n你好，我很好。谢谢你。\r\n"
+	)
+
+	le := utf16.UTF16(utf16.LittleEndian, utf16.IgnoreBOM)
+	leBOM := utf16.UTF16(utf16.LittleEndian, utf16.UseBOM)
+	be := utf16.UTF16(utf16.BigEndian, utf16.UseBOM)
+
+	tests := []struct {
+		name string
+		in   []byte
+		hint provider.Language
+		exp  string
+		enc  string
+	}{
+		{"utf8", []byte(ru), provider.LangRussian, ru, UTF8},
+		{"utf8 bom", append([]byte{0xef, 0xbb, 0xbf}, fr...), "", fr, UTF8BOM},
+		{"utf16le bom", encode(t, leBOM, fr), "", fr, UTF16LE},
+		{"utf16be bom", encode(t, be, ru), "", ru, UTF16BE},
+		{"utf16le", encode(t, le, fr), "", fr, UTF16LE},
+		{"cp1251", encode(t, charmap.Windows1251, ru), provider.LangRussian, ru, "windows-1251"},
+		{"koi8-r", encode(t, charmap.KOI8R, ru), provider.LangRussian, ru, "koi8-r"},
+		{"cp1253", encode(t, charmap.Windows1253, el), provider.LangGreek, el, "windows-1253"},
+		{"cp1252", encode(t, charmap.Windows1252, fr), provider.LangFrench, fr, "windows-1252"},
+		{"no hint", encode(t, charmap.Windows1252, fr), "", fr, "windows-1252"},
+		{"gb18030", encode(t, simplifiedchinese.GB18030, zh), provider.LangChinese, zh, "gb18030"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, enc, err := ToUTF8(test.in, test.hint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if enc != test.enc {
+				t.Errorf("expected encoding %s, got %s", test.enc, enc)
+			}
+			if string(out) != test.exp {
+				t.Errorf("unexpected output %q", out)
+			}
+		})
+	}
+}
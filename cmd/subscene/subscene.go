@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -12,9 +13,14 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/frizinak/subscene/archive"
 	"github.com/frizinak/subscene/fuzzy"
+	"github.com/frizinak/subscene/provider"
 	"github.com/frizinak/subscene/subscene"
+	"github.com/frizinak/subscene/subtitle"
 	"github.com/mattn/go-runewidth"
 )
 
@@ -64,18 +70,15 @@ func choice(list []string, w int) ([]int, error) {
 		fmt.Printf(f, i+1, r)
 	}
 
-	sc := bufio.NewScanner(os.Stdin)
-	sc.Split(bufio.ScanLines)
-
 	var ints []int
 	var ok bool
 	for {
 		fmt.Print("\033[34mWhich? \033[0m")
-		if !sc.Scan() {
+		if !stdin.Scan() {
 			break
 		}
 
-		ints, ok = intRange(strings.TrimSpace(sc.Text()))
+		ints, ok = intRange(strings.TrimSpace(stdin.Text()))
 		if ok && len(ints) != 0 {
 			for i, choice := range ints {
 				choice--
@@ -92,7 +95,7 @@ func choice(list []string, w int) ([]int, error) {
 	}
 
 	fmt.Print("\033[0m")
-	if err := sc.Err(); err != nil {
+	if err := stdin.Err(); err != nil {
 		panic(err)
 	}
 	if len(ints) == 0 {
@@ -102,12 +105,52 @@ func choice(list []string, w int) ([]int, error) {
 	return ints, nil
 }
 
+// stdin is shared by all prompts, a scanner per prompt would lose the input
+// buffered by the previous one.
+var (
+	stdin   = bufio.NewScanner(os.Stdin)
+	stdinMu sync.Mutex
+)
+
+// askPassword prompts for the password of an encrypted archive,
+// downloads run concurrently so only one prompt is shown at a time.
+func askPassword(name string) (string, error) {
+	stdinMu.Lock()
+	defer stdinMu.Unlock()
+
+	fmt.Printf("\033[34m%s is encrypted, password (empty to skip): \033[0m", name)
+	if !stdin.Scan() {
+		return "", stdin.Err()
+	}
+	return strings.TrimSpace(stdin.Text()), nil
+}
+
 func exit(err error) {
 	if err == nil {
 		return
 	}
-	fmt.Fprintln(os.Stderr, err.Error())
-	os.Exit(1)
+
+	code, msg := 1, err.Error()
+	var herr *subscene.HTTPError
+	switch {
+	case errors.Is(err, subscene.ErrRateLimited):
+		code, msg = 3, "subscene is throttling us, try again later: "+msg
+	case errors.Is(err, subscene.ErrNotFound):
+		code, msg = 4, "not found on subscene: "+msg
+	case errors.Is(err, subscene.ErrNoDownloadLink):
+		code = 5
+	case errors.Is(err, subscene.ErrTooLarge):
+		code = 6
+	case errors.Is(err, subscene.ErrEncrypted):
+		code, msg = 8, "encrypted archive, see -password: "+msg
+	case errors.Is(err, subscene.ErrMissingVolume):
+		code = 9
+	case errors.As(err, &herr):
+		code = 7
+	}
+
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(code)
 }
 
 func termSize() (int, int) {
@@ -124,18 +167,105 @@ func termSize() (int, int) {
 	return x, y
 }
 
+func parseAnchors(s string) (a, b subtitle.Anchor, err error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return a, b, fmt.Errorf("invalid -sync value %q, expected two anchors", s)
+	}
+
+	anchors := make([]subtitle.Anchor, 2)
+	for i, f := range fields {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return a, b, fmt.Errorf("invalid anchor %q", f)
+		}
+		if anchors[i].Cue, err = strconv.Atoi(kv[0]); err != nil {
+			return a, b, fmt.Errorf("invalid anchor %q: %w", f, err)
+		}
+		if anchors[i].At, err = subtitle.ParseTimestamp(kv[1]); err != nil {
+			return a, b, fmt.Errorf("invalid anchor %q: %w", f, err)
+		}
+	}
+
+	return anchors[0], anchors[1], nil
+}
+
+// retimer returns the retiming requested with -shift, -fps and -sync,
+// nil if none was.
+func retimer(shift time.Duration, fps, sync string) (func(path string) error, error) {
+	if sync != "" {
+		if shift != 0 || fps != "" {
+			return nil, errors.New("-sync can not be combined with -shift or -fps")
+		}
+		a, b, err := parseAnchors(sync)
+		return func(path string) error { return subtitle.SyncFile(path, a, b) }, err
+	}
+
+	var r subtitle.Retime
+	if fps != "" {
+		rates := strings.SplitN(fps, ":", 2)
+		if len(rates) != 2 {
+			return nil, fmt.Errorf("invalid -fps value %q", fps)
+		}
+		from, err := strconv.ParseFloat(rates[0], 64)
+		if err != nil || from <= 0 {
+			return nil, fmt.Errorf("invalid -fps value %q", fps)
+		}
+		to, err := strconv.ParseFloat(rates[1], 64)
+		if err != nil || to <= 0 {
+			return nil, fmt.Errorf("invalid -fps value %q", fps)
+		}
+		r = subtitle.Stretch(from, to)
+	}
+	if shift != 0 {
+		if r == nil {
+			r = subtitle.Shift(shift)
+		} else {
+			r = r.Then(subtitle.Shift(shift))
+		}
+	}
+	if r == nil {
+		return nil, nil
+	}
+
+	return func(path string) error { return subtitle.RetimeFile(path, r) }, nil
+}
+
 func main() {
 	var i bool
 	var q bool
 	var lang string
 	var hi bool
-	flag.StringVar(&lang, "l", string(subscene.LangEnglish), "subtitle language")
+	var nohi bool
+	var nested int
+	var concurrency int
+	var utf8 bool
+	var password string
+	var overwrite string
+	var vtt string
+	var shift time.Duration
+	var fps string
+	var anchors string
+	var retime bool
+	flag.StringVar(&lang, "l", string(provider.LangEnglish), "subtitle language")
 	flag.BoolVar(&i, "i", false, "run interactively instead of picking the first result")
 	flag.BoolVar(&hi, "hi", false, "prefer subtitles for the hearing impaired")
+	flag.BoolVar(&nohi, "nohi", false, "strip hearing impaired annotations ([DOOR SLAMS], (laughing), lyrics, JOHN:) from downloaded subtitles")
 	flag.BoolVar(&q, "q", false, "sush")
+	flag.IntVar(&nested, "nested", 2, "how many levels of archives within archives to extract")
+	flag.IntVar(&concurrency, "j", 4, "how many subtitles to download at once")
+	flag.BoolVar(&utf8, "utf8", true, "convert subtitles to UTF-8")
+	flag.StringVar(&overwrite, "overwrite", "skip", "what to do with existing subtitles: skip, overwrite, number (keep both) or update (if larger or newer)")
+	flag.StringVar(&vtt, "vtt", "", "convert subtitles to WebVTT, 'add' writes a .vtt next to the original, 'replace' removes the original")
+	flag.StringVar(&password, "password", "", "password for encrypted archives, asked for in interactive mode if omitted")
+	flag.DurationVar(&shift, "shift", 0, "shift subtitles by this duration, e.g.: -1.5s")
+	flag.StringVar(&fps, "fps", "", "stretch subtitles from one framerate to another, e.g.: 23.976:25")
+	flag.StringVar(&anchors, "sync", "", "sync subtitles to two anchors, e.g.: '1=0:00:05.000 120=0:42:10.500' starts cue 1 at 5s and cue 120 at 42m10.5s")
+	flag.BoolVar(&retime, "retime", false, "retime the subtitle files given as arguments with -shift, -fps or -sync instead of downloading")
 	flag.Usage = func() {
 		fmt.Println("Usage of subscene")
 		fmt.Println("subscene [opts] <media query> <subtitle query>")
+		fmt.Println("subscene -retime [-shift <duration>] [-fps <from:to>] [-sync <anchors>] <file>...")
 		flag.PrintDefaults()
 		fmt.Println()
 		fmt.Println("<title query>:")
@@ -148,13 +278,50 @@ func main() {
 		fmt.Println("                         and the subtitles will be unzipped here.")
 		fmt.Println("         is a file:      the filename without extension will be used as query")
 		fmt.Println("                         and only the first subtitle will be stored with the same")
-		fmt.Println("                         filename + '.srt'.")
+		fmt.Println("                         filename and the subtitle's extension.")
 		fmt.Println("                         e.g.: subscene 'line of duty second' ~/owneddvdrips/line-of-duty-s02e03.avi")
 		fmt.Println("                               should result in ~/owneddvdrips/line-of-duty-s02e03.srt")
 		fmt.Println()
+		fmt.Println("Retiming:")
+		fmt.Println("    -shift, -fps and -sync are applied to all downloaded subtitles, or with -retime")
+		fmt.Println("    to the given files. -fps is applied before -shift, -sync can not be combined.")
+		fmt.Println()
+		fmt.Println("Exit codes:")
+		fmt.Println("    1: generic error")
+		fmt.Println("    3: rate limited by subscene")
+		fmt.Println("    4: not found")
+		fmt.Println("    5: subtitle page has no download link")
+		fmt.Println("    6: download too large")
+		fmt.Println("    7: unexpected http status")
+		fmt.Println("    8: encrypted archive")
+		fmt.Println("    9: multi-volume archive with missing volumes")
+		fmt.Println()
 	}
 	flag.Parse()
 
+	rt, err := retimer(shift, fps, anchors)
+	exit(err)
+
+	if retime {
+		if rt == nil {
+			exit(errors.New("-retime needs -shift, -fps or -sync"))
+		}
+		var errs provider.Errors
+		for _, path := range flag.Args() {
+			if err := rt(path); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", path, err))
+				continue
+			}
+			if !q {
+				fmt.Printf("\033[1;30;42m Retimed \033[0m %s\n", path)
+			}
+		}
+		if len(errs) != 0 {
+			exit(errs)
+		}
+		return
+	}
+
 	w, _ := termSize()
 
 	query := strings.TrimSpace(flag.Arg(0))
@@ -183,9 +350,33 @@ func main() {
 	}
 	fq = fileQueryRE.ReplaceAllString(fq, "")
 
-	api := subscene.New(nil)
+	policy, err := archive.ParsePolicy(overwrite)
+	exit(err)
+
+	if vtt != "" && vtt != "add" && vtt != "replace" {
+		exit(fmt.Errorf("invalid -vtt value %q", vtt))
+	}
+
+	var ask func(string) (string, error)
+	if i {
+		ask = askPassword
+	}
+
+	opts := []subscene.Option{
+		subscene.WithLanguages(provider.Language(lang)),
+		subscene.WithNested(nested, 0),
+		subscene.WithUTF8(utf8),
+		subscene.WithPassword(password, ask),
+		subscene.WithOverwrite(policy),
+	}
+	if vtt != "" {
+		opts = append(opts, subscene.WithConvert(subtitle.VTT, vtt == "replace"))
+	}
 
-	res, err := api.Search(query, 30)
+	ctx := context.Background()
+	var p provider.Provider = subscene.New(nil, opts...).Provider()
+
+	res, err := p.Search(ctx, query)
 	exit(err)
 
 	if len(res) == 0 {
@@ -217,14 +408,14 @@ func main() {
 		fmt.Println()
 	}
 
-	downloads := make(subscene.Downloads, 0)
+	downloads := make(provider.Downloads, 0)
 	for _, ix := range ixs {
-		dls, err := api.Subtitles(res[ix], 100)
+		dls, err := p.List(ctx, res[ix])
 		exit(err)
 		downloads = append(downloads, dls...)
 	}
 	strs = strs[:0]
-	downloads = downloads.FilterLanguage(subscene.Language(lang))
+	downloads = downloads.FilterLanguage(provider.Language(lang))
 	for _, dl := range downloads {
 		hi := ""
 		if dl.HI {
@@ -244,7 +435,7 @@ func main() {
 
 		ms := top.FindAllString(fq, -1)
 		headstr := make([]string, 0, len(strs))
-		headdl := make(subscene.Downloads, 0, len(downloads))
+		headdl := make(provider.Downloads, 0, len(downloads))
 		for _, m := range ms {
 			m = strings.ToLower(m)
 			for i := 0; i < len(strs); i++ {
@@ -297,11 +488,38 @@ func main() {
 		fmt.Println()
 	}
 
-	cb := func(i subscene.ZipInfo) {
+	cb := func(i provider.ZipInfo) {
+		stripped := make(map[string]error)
+		if nohi {
+			for _, path := range i.Paths() {
+				if err := subtitle.StripHIFile(path); !errors.Is(err, subtitle.ErrFormat) {
+					stripped[path] = err
+				}
+			}
+		}
+
+		retimed := make(map[string]error)
+		if rt != nil {
+			for _, path := range i.Paths() {
+				if err := rt(path); !errors.Is(err, subtitle.ErrFormat) {
+					retimed[path] = err
+				}
+			}
+		}
+
 		if q {
 			return
 		}
 
+		if errors.Is(i.Err, subscene.ErrEncrypted) {
+			fmt.Printf(
+				"\033[1;30;43m Skipped \033[0m %s is encrypted, use -password or -i\n%s\n\n",
+				i.Filename,
+				i.URI.String(),
+			)
+			return
+		}
+
 		if i.Err != nil {
 			fmt.Printf(
 				"\033[1;37;41m Fail \033[0m %s\n%s\n%s\n\n",
@@ -314,16 +532,54 @@ func main() {
 
 		fmt.Printf("\033[1;30;42m Downloaded \033[0m %s\n", i.Filename)
 		for k, v := range i.Extracted {
-			if v == "" {
-				v = "skipped"
+			notes := make([]string, 0, 2)
+			if v.Existed {
+				notes = append(notes, "exists: "+v.Policy.String())
+			}
+			if v.Encoding != "" && v.Encoding != "utf-8" {
+				notes = append(notes, "from "+v.Encoding)
+			}
+			note := ""
+			if len(notes) != 0 {
+				note = " (" + strings.Join(notes, ", ") + ")"
+			}
+
+			switch {
+			case v.Err != nil:
+				fmt.Printf("    - %s -> rejected: %s\n", k, v.Err)
+			case v.Path == "":
+				fmt.Printf("    - %s -> skipped%s\n", k, note)
+			default:
+				fmt.Printf("    - %s -> %s%s\n", k, v.Path, note)
+			}
+
+			if c, ok := i.Converted[k]; ok {
+				switch {
+				case c.Err != nil:
+					fmt.Printf("      conversion failed: %s\n", c.Err)
+				case c.Path == "":
+					fmt.Printf("      not converted (exists: %s)\n", c.Policy)
+				case c.Path != v.Path:
+					fmt.Printf("      converted to %s\n", c.Path)
+				}
+			}
+		}
+		for _, path := range i.Paths() {
+			if err, ok := stripped[path]; ok && err != nil {
+				fmt.Printf("    ! stripping hearing impaired annotations from %s failed: %s\n", path, err)
+			} else if ok {
+				fmt.Printf("    - stripped hearing impaired annotations from %s\n", path)
+			}
+			if err, ok := retimed[path]; ok && err != nil {
+				fmt.Printf("    ! retiming %s failed: %s\n", path, err)
+			} else if ok {
+				fmt.Printf("    - retimed %s\n", path)
 			}
-			fmt.Printf("    - %s -> %s\n", k, v)
 		}
 		fmt.Println()
 	}
 
-	exit(api.Get(downloads, dir, fp, 20, cb))
-	exit(err)
+	exit(provider.Get(ctx, p, downloads, dir, fp, concurrency, cb))
 	if !q {
 		fmt.Println("Done")
 	}
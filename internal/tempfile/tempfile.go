@@ -0,0 +1,44 @@
+// Package tempfile creates the temporary files that are renamed over a
+// destination once they are completely written.
+package tempfile
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Create creates a new temporary file next to path. Unlike os.CreateTemp,
+// which always uses 0600, the file gets the permissions of path if it
+// exists or those os.Create would give it otherwise.
+func Create(path string) (*os.File, error) {
+	stat, _ := os.Stat(path)
+	perm := os.FileMode(0666)
+	if stat != nil {
+		perm = stat.Mode().Perm()
+	}
+
+	dir, base := filepath.Split(path)
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, "."+base+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && try < 1000 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The umask applies to perm, an existing file's mode should not
+		// change.
+		if stat != nil {
+			if err := f.Chmod(perm); err != nil {
+				_ = f.Close()
+				_ = os.Remove(name)
+				return nil, err
+			}
+		}
+		return f, nil
+	}
+}
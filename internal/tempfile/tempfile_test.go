@@ -0,0 +1,44 @@
+//go:build unix
+
+package tempfile
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	old := syscall.Umask(022)
+	defer syscall.Umask(old)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "movie.srt")
+	f, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if stat, _ := os.Stat(f.Name()); stat.Mode().Perm() != 0644 {
+		t.Errorf("new file: expected 0644, got %v", stat.Mode().Perm())
+	}
+	if filepath.Dir(f.Name()) != dir {
+		t.Errorf("not created next to %s: %s", path, f.Name())
+	}
+
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0664); err != nil {
+		t.Fatal(err)
+	}
+	f, err = Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if stat, _ := os.Stat(f.Name()); stat.Mode().Perm() != 0664 {
+		t.Errorf("existing file: expected 0664, got %v", stat.Mode().Perm())
+	}
+}
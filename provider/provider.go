@@ -0,0 +1,93 @@
+// Package provider defines the types shared by all subtitle backends.
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Provider is a subtitle backend.
+type Provider interface {
+	// Search returns the media titles matching query.
+	Search(ctx context.Context, query string) (SearchResults, error)
+	// List returns all subtitles available for r.
+	List(ctx context.Context, r *SearchResult) (Downloads, error)
+	// Fetch downloads d and extracts its subtitles to dir. If name is not
+	// empty only a single subtitle is stored, named after name.
+	Fetch(ctx context.Context, d *Download, dir, name string) ZipInfo
+}
+
+// DownloadError wraps the failure of a single Download.
+type DownloadError struct {
+	Download *Download
+	Err      error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Download, e.Err)
+}
+
+func (e *DownloadError) Unwrap() error { return e.Err }
+
+// Errors is a collection of errors that is itself an error.
+type Errors []error
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e Errors) Unwrap() []error { return e }
+
+// Get fetches all d using p, at most concurrency at a time.
+// cb is never called concurrently. If any fetch fails the returned
+// error is an Errors of *DownloadError.
+func Get(ctx context.Context, p Provider, d Downloads, dir, name string, concurrency int, cb func(ZipInfo)) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var errs Errors
+	var mut sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, dl := range d {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(dl *Download) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			z := p.Fetch(ctx, dl, dir, name)
+
+			mut.Lock()
+			defer mut.Unlock()
+			if cb != nil {
+				cb(z)
+			}
+			if z.Err != nil {
+				errs = append(errs, &DownloadError{dl, z.Err})
+			}
+		}(dl)
+	}
+
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
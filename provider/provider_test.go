@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fake struct {
+	cur, max int32
+	fail     *Download
+}
+
+func (f *fake) Search(context.Context, string) (SearchResults, error)  { return nil, nil }
+func (f *fake) List(context.Context, *SearchResult) (Downloads, error) { return nil, nil }
+
+func (f *fake) Fetch(ctx context.Context, d *Download, dir, name string) ZipInfo {
+	n := atomic.AddInt32(&f.cur, 1)
+	defer atomic.AddInt32(&f.cur, -1)
+	for {
+		m := atomic.LoadInt32(&f.max)
+		if n <= m || atomic.CompareAndSwapInt32(&f.max, m, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if d == f.fail {
+		return ZipInfo{Err: errors.New("failed")}
+	}
+	return ZipInfo{}
+}
+
+func TestGetConcurrency(t *testing.T) {
+	d := make(Downloads, 20)
+	for i := range d {
+		d[i] = &Download{}
+	}
+
+	for _, limit := range []int{1, 3, 8} {
+		f := &fake{fail: d[5]}
+		var n int
+		err := Get(context.Background(), f, d, "", "", limit, func(ZipInfo) { n++ })
+		if f.max > int32(limit) {
+			t.Errorf("limit %d: %d downloads ran at once", limit, f.max)
+		}
+		if f.max != int32(limit) {
+			t.Errorf("limit %d: expected the limit to be reached, got %d", limit, f.max)
+		}
+		if n != len(d) {
+			t.Errorf("limit %d: expected %d callbacks, got %d", limit, len(d), n)
+		}
+		var errs Errors
+		var derr *DownloadError
+		if !errors.As(err, &errs) || len(errs) != 1 || !errors.As(errs[0], &derr) || derr.Download != d[5] {
+			t.Errorf("limit %d: unexpected error %v", limit, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/frizinak/subscene/archive"
+)
+
+type SearchResults []*SearchResult
+
+func (s SearchResults) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+type SearchResult struct {
+	URI   *url.URL
+	Title string
+	Subs  int
+}
+
+func (s *SearchResult) String() string { return s.Title }
+
+type Downloads []*Download
+
+func (d Downloads) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+
+func (d Downloads) FilterLanguage(l Language) Downloads {
+	dls := make(Downloads, 0, len(d))
+	for _, dl := range d {
+		if dl.Lang == l {
+			dls = append(dls, dl)
+		}
+	}
+
+	return dls
+}
+
+func (d Downloads) FilterN(n ...int) Downloads {
+	dls := make(Downloads, 0, len(n))
+	for _, ix := range n {
+		if ix < 0 || ix >= len(d) {
+			panic("out of bounds")
+		}
+		dls = append(dls, d[ix])
+	}
+
+	return dls
+}
+
+type Download struct {
+	Lang    Language
+	URI     *url.URL
+	Title   string
+	Author  string
+	Comment string
+	HI      bool
+}
+
+func (s *Download) String() string { return s.Title }
+
+type Language string
+
+const (
+	LangEnglish              Language = "english"
+	LangDutch                Language = "dutch"
+	LangArabic               Language = "arabic"
+	LangBengali              Language = "bengali"
+	LangBig_5_code           Language = "big_5_code"
+	LangBrazillianPortuguese Language = "brazillian"
+	LangBurmese              Language = "burmese"
+	LangChinese              Language = "chinese"
+	LangCroatian             Language = "croatian"
+	LangDanish               Language = "danish"
+	LangEstonian             Language = "estonian"
+	LangFarsi_persian        Language = "farsi_persian"
+	LangFinnish              Language = "finnish"
+	LangFrench               Language = "french"
+	LangGerman               Language = "german"
+	LangGreek                Language = "greek"
+	LangHebrew               Language = "hebrew"
+	LangIndonesian           Language = "indonesian"
+	LangItalian              Language = "italian"
+	LangJapanese             Language = "japanese"
+	LangKorean               Language = "korean"
+	LangLatvian              Language = "latvian"
+	LangLithuanian           Language = "lithuanian"
+	LangMalay                Language = "malay"
+	LangMalayalam            Language = "malayalam"
+	LangNorwegian            Language = "norwegian"
+	LangPolish               Language = "polish"
+	LangPortuguese           Language = "portuguese"
+	LangRussian              Language = "russian"
+	LangSerbian              Language = "serbian"
+	LangSinhala              Language = "sinhala"
+	LangSlovenian            Language = "slovenian"
+	LangSpanish              Language = "spanish"
+	LangSwedish              Language = "swedish"
+	LangThai                 Language = "thai"
+	LangTurkish              Language = "turkish"
+	LangVietnamese           Language = "vietnamese"
+)
+
+type ZipInfo struct {
+	URI       *url.URL
+	Filename  string
+	Extracted map[string]archive.Result
+	// Converted holds the result of converting extracted subtitles to
+	// another format, keyed like Extracted.
+	Converted map[string]archive.Result
+	Err       error
+}
+
+// Paths returns the files that were written for z, both extracted and
+// converted, in lexical order.
+func (z ZipInfo) Paths() []string {
+	n := len(z.Extracted) + len(z.Converted)
+	seen := make(map[string]struct{}, n)
+	paths := make([]string, 0, n)
+	for _, m := range []map[string]archive.Result{z.Extracted, z.Converted} {
+		for _, r := range m {
+			if _, ok := seen[r.Path]; ok || r.Path == "" {
+				continue
+			}
+			seen[r.Path] = struct{}{}
+			paths = append(paths, r.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -1,7 +1,7 @@
 package subscene
 
 import (
-	"errors"
+	"context"
 	"io"
 	"net/http"
 	"net/url"
@@ -9,51 +9,227 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/frizinak/subscene/archive"
+	"github.com/frizinak/subscene/subtitle"
 )
 
 type API struct {
-	c   *http.Client //= http.DefaultClient
-	req chan struct{}
+	c           *http.Client //= http.DefaultClient
+	limiter     *Limiter
+	shared      bool
+	retry       RetryPolicy
+	concurrency int
+	cookie      string
+	base        *url.URL
+	nestedDepth int
+	nestedSize  int64
+	maxSize     int64
+	exts        extensions
+	langs       []Language
+	utf8        bool
+	password    string
+	askPassword func(name string) (string, error)
+	policy      archive.Policy
+	convert     subtitle.Format
+	replace     bool
+}
+
+type options struct {
+	interval    time.Duration
+	burst       int
+	limiter     *Limiter
+	retry       RetryPolicy
+	concurrency int
+	langs       []Language
+	hi          HIMode
+	base        *url.URL
+	nestedDepth int
+	nestedSize  int64
+	maxSize     int64
+	exts        []string
+	utf8        bool
+	password    string
+	askPassword func(name string) (string, error)
+	policy      archive.Policy
+	convert     subtitle.Format
+	replace     bool
+}
+
+type Option func(*options)
+
+// WithRate sets the minimum interval between requests and how many
+// requests can be made back to back. Defaults to 300ms and 1, an interval
+// <= 0 disables rate limiting.
+func WithRate(interval time.Duration, burst int) Option {
+	return func(o *options) {
+		o.interval = interval
+		o.burst = burst
+	}
+}
+
+// WithLimiter makes the API use a shared Limiter instead of creating its own.
+// Closing the API will not close l.
+func WithLimiter(l *Limiter) Option {
+	return func(o *options) { o.limiter = l }
+}
+
+// WithConcurrency caps the number of downloads API.Get runs at once,
+// provider.Get takes its own limit.
+// Defaults to 4.
+func WithConcurrency(n int) Option {
+	return func(o *options) { o.concurrency = n }
+}
+
+// WithBaseURL points the API at a different host than https://subscene.com,
+// e.g.: a subscenetest.Server.
+func WithBaseURL(u *url.URL) Option {
+	return func(o *options) { o.base = u }
+}
+
+// WithNested makes Download descend into archives within archives up to
+// depth levels deep, buffering at most maxSize bytes in total for them.
+// See archive.Options.
+func WithNested(depth int, maxSize int64) Option {
+	return func(o *options) {
+		o.nestedDepth = depth
+		o.nestedSize = maxSize
+	}
+}
+
+// WithMaxSize limits the size of a single download,
+// defaults to archive.DefaultMaxSize.
+func WithMaxSize(n int64) Option {
+	return func(o *options) { o.maxSize = n }
+}
+
+// WithExtensions sets the extensions of the files Download extracts,
+// matched case-insensitively. Defaults to SubtitleExts.
+func WithExtensions(exts ...string) Option {
+	return func(o *options) { o.exts = exts }
+}
+
+// WithUTF8 makes Download detect the encoding of extracted subtitles and
+// convert them to UTF-8. The detected encoding is stored in
+// ZipInfo.Extracted.
+func WithUTF8(enabled bool) Option {
+	return func(o *options) { o.utf8 = enabled }
+}
+
+// WithPassword sets the password used for encrypted archives. ask, if not
+// nil, is called with the archive's filename when password is empty or
+// wrong, see archive.ReaderOptions.PasswordFunc. Encrypted archives fail
+// with ErrEncrypted otherwise.
+func WithPassword(password string, ask func(name string) (string, error)) Option {
+	return func(o *options) {
+		o.password = password
+		o.askPassword = ask
+	}
 }
 
-func New(c *http.Client) *API {
+// WithOverwrite sets what Download does with subtitles that already exist,
+// defaults to archive.Skip.
+func WithOverwrite(p archive.Policy) Option {
+	return func(o *options) { o.policy = p }
+}
+
+// WithConvert makes Download convert the subtitles it extracts to format f,
+// e.g.: subtitle.VTT. The converted file is written next to the original
+// which is removed if replace is true. See ZipInfo.Converted.
+func WithConvert(f subtitle.Format, replace bool) Option {
+	return func(o *options) {
+		o.convert = f
+		o.replace = replace
+	}
+}
+
+func New(c *http.Client, opts ...Option) *API {
 	if c == nil {
 		c = http.DefaultClient
 	}
 
-	req := make(chan struct{})
-	go func() {
-		for {
-			req <- struct{}{}
-			time.Sleep(time.Millisecond * 300)
-		}
-	}()
+	o := options{
+		interval:    time.Millisecond * 300,
+		burst:       1,
+		retry:       DefaultRetryPolicy,
+		concurrency: 4,
+		base:        defaultBase,
+		exts:        SubtitleExts,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	api := &API{
+		c:           c,
+		limiter:     o.limiter,
+		shared:      o.limiter != nil,
+		retry:       o.retry,
+		concurrency: o.concurrency,
+		cookie:      filterCookie(o.langs, o.hi),
+		base:        o.base,
+		nestedDepth: o.nestedDepth,
+		nestedSize:  o.nestedSize,
+		maxSize:     o.maxSize,
+		exts:        newExtensions(o.exts),
+		langs:       o.langs,
+		utf8:        o.utf8,
+		password:    o.password,
+		askPassword: o.askPassword,
+		policy:      o.policy,
+		convert:     o.convert,
+		replace:     o.replace,
+	}
+	if api.concurrency < 1 {
+		api.concurrency = 1
+	}
+	if !api.shared {
+		api.limiter = NewLimiter(o.interval, o.burst)
+	}
 
-	return &API{c, req}
+	return api
+}
+
+// Close stops the rate limiter unless it is shared.
+func (api *API) Close() error {
+	if api.shared {
+		return nil
+	}
+	return api.limiter.Close()
 }
 
 const ua = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/87.0.4280.88 Safari/537.36"
 
 var absURLRE = regexp.MustCompile(`^https?:`)
-var base, _ = url.Parse("https://subscene.com")
+var defaultBase, _ = url.Parse("https://subscene.com")
 
-func safeReq(req *http.Request) *http.Request {
+func (api *API) safeReq(req *http.Request) *http.Request {
 	req.Header.Set("User-Agent", ua)
+	if req.URL.Host == api.base.Host && api.cookie != "" {
+		cookie := api.cookie
+		if c := req.Header.Get("Cookie"); c != "" {
+			cookie = c + "; " + cookie
+		}
+		req.Header.Set("Cookie", cookie)
+	}
 	return req
 }
 
-func (api *API) doReq(req *http.Request) (*http.Response, error) {
-	<-api.req
-	return api.c.Do(safeReq(req))
+func (api *API) doReq(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if err := api.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return api.c.Do(api.safeReq(req.WithContext(ctx)))
 }
 
-func uri(paths ...string) *url.URL {
-	u := *base
+func (api *API) uri(paths ...string) *url.URL {
+	u := *api.base
 	u.Path = path.Join(paths...)
 	return &u
 }
 
-func href(href string) (*url.URL, error) {
+func (api *API) href(href string) (*url.URL, error) {
+	base := api.base
 	uri := &url.URL{}
 	*uri = *base
 	var err error
@@ -78,18 +254,3 @@ func href(href string) (*url.URL, error) {
 }
 
 func queryBody(q url.Values) io.Reader { return strings.NewReader(q.Encode()) }
-
-func shouldRetry(res *http.Response, retries int) (bool, error) {
-	if res.StatusCode == http.StatusConflict {
-		if retries > 0 {
-			return true, nil
-		}
-		return false, errors.New("too many requests")
-	}
-
-	if res.StatusCode != http.StatusOK {
-		return false, errors.New(res.Status)
-	}
-
-	return false, nil
-}
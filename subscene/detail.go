@@ -0,0 +1,123 @@
+package subscene
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var dateLayouts = []string{
+	"1/2/2006 3:04 PM",
+	"1/2/2006 15:04",
+	"1/2/2006",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// SubtitleDetail is everything subscene lists on a subtitle's own page.
+type SubtitleDetail struct {
+	URI      *url.URL
+	Title    string
+	Releases []string
+	Uploaded time.Time
+	// Rating is the score out of 10, 0 if the subtitle has not been rated.
+	Rating      int
+	Votes       int
+	Downloads   int
+	HI          bool
+	Uploader    string
+	UploaderURI *url.URL
+	Notes       string
+	DownloadURI *url.URL
+}
+
+func (s *SubtitleDetail) String() string { return s.Title }
+
+func (api *API) Detail(d *Download) (*SubtitleDetail, error) {
+	return api.DetailContext(context.Background(), d)
+}
+
+func (api *API) DetailContext(ctx context.Context, d *Download) (*SubtitleDetail, error) {
+	res, err := api.do(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", d.URI.String(), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.parseDetail(d.URI, doc), nil
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(intRE.FindString(strings.ReplaceAll(s, ",", "")))
+	return n
+}
+
+func (api *API) parseDetail(u *url.URL, doc *goquery.Document) *SubtitleDetail {
+	d := &SubtitleDetail{URI: u}
+	header := doc.Find(".top .header").First()
+	d.Title = strings.TrimSpace(header.Find("h1 span").First().Text())
+
+	author := header.Find(".author a").First()
+	d.Uploader = strings.TrimSpace(author.Text())
+	if hr, ok := author.Attr("href"); ok {
+		d.UploaderURI, _ = api.href(hr)
+	}
+
+	header.Find(".release div").Each(func(i int, s *goquery.Selection) {
+		if r := strings.TrimSpace(s.Text()); r != "" {
+			d.Releases = append(d.Releases, r)
+		}
+	})
+
+	d.Notes = strings.TrimSpace(header.Find(".comment").Text())
+
+	rating := doc.Find(".rating").First()
+	if v := rating.Find("[itemprop=ratingValue]"); v.Length() != 0 {
+		d.Rating = atoi(v.Text())
+	} else {
+		d.Rating = atoi(rating.Find("span").First().Text())
+	}
+	if v := rating.Find("[itemprop=ratingCount]"); v.Length() != 0 {
+		d.Votes = atoi(v.Text())
+	} else {
+		d.Votes = atoi(rating.Find(".r-info").Text())
+	}
+
+	doc.Find("#details li").Each(func(i int, s *goquery.Selection) {
+		label := strings.ToLower(strings.TrimSpace(s.Find("strong").Text()))
+		c := s.Clone()
+		c.Find("strong").Remove()
+		value := strings.TrimSpace(c.Text())
+		switch {
+		case strings.HasPrefix(label, "online"):
+			for _, l := range dateLayouts {
+				if t, err := time.Parse(l, value); err == nil {
+					d.Uploaded = t
+					break
+				}
+			}
+		case strings.HasPrefix(label, "hearing impaired"):
+			d.HI = strings.EqualFold(value, "yes")
+		case strings.HasPrefix(label, "downloads"):
+			d.Downloads = atoi(value)
+		}
+	})
+
+	if hr, ok := doc.Find(".download a").Attr("href"); ok {
+		d.DownloadURI, _ = api.href(hr)
+	}
+
+	return d
+}
@@ -0,0 +1,59 @@
+package subscene
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/frizinak/subscene/archive"
+	"github.com/frizinak/subscene/provider"
+)
+
+var (
+	ErrRateLimited    = errors.New("too many requests")
+	ErrNotFound       = errors.New("not found")
+	ErrNoDownloadLink = errors.New("missing download link")
+	ErrTooLarge       = archive.ErrTooLarge
+	ErrEncrypted      = archive.ErrEncrypted
+	ErrMissingVolume  = archive.ErrMissingVolume
+)
+
+// HTTPError is returned when subscene responds with an unexpected status.
+// It matches ErrNotFound and ErrRateLimited with errors.Is where applicable.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	URL        *url.URL
+}
+
+func (e *HTTPError) Error() string {
+	if e.URL == nil {
+		return e.Status
+	}
+	return fmt.Sprintf("%s: %s", e.URL, e.Status)
+}
+
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusConflict ||
+			e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+func statusErr(res *http.Response) error {
+	var u *url.URL
+	if res.Request != nil {
+		u = res.Request.URL
+	}
+	return &HTTPError{StatusCode: res.StatusCode, Status: res.Status, URL: u}
+}
+
+type (
+	DownloadError = provider.DownloadError
+	Errors        = provider.Errors
+)
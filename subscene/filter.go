@@ -0,0 +1,104 @@
+package subscene
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/frizinak/subscene/provider"
+)
+
+var languageIDs = map[Language]int{
+	provider.LangArabic:               2,
+	provider.LangBig_5_code:           3,
+	provider.LangBrazillianPortuguese: 4,
+	provider.LangChinese:              7,
+	provider.LangCroatian:             8,
+	provider.LangDanish:               10,
+	provider.LangDutch:                11,
+	provider.LangEnglish:              13,
+	provider.LangEstonian:             16,
+	provider.LangFinnish:              17,
+	provider.LangFrench:               18,
+	provider.LangGerman:               19,
+	provider.LangGreek:                21,
+	provider.LangHebrew:               22,
+	provider.LangItalian:              26,
+	provider.LangJapanese:             27,
+	provider.LangKorean:               28,
+	provider.LangLatvian:              29,
+	provider.LangNorwegian:            30,
+	provider.LangPolish:               31,
+	provider.LangPortuguese:           32,
+	provider.LangRussian:              34,
+	provider.LangSerbian:              35,
+	provider.LangSlovenian:            37,
+	provider.LangSpanish:              38,
+	provider.LangSwedish:              39,
+	provider.LangThai:                 40,
+	provider.LangTurkish:              41,
+	provider.LangLithuanian:           43,
+	provider.LangIndonesian:           44,
+	provider.LangVietnamese:           45,
+	provider.LangFarsi_persian:        46,
+	provider.LangMalay:                50,
+	provider.LangBengali:              54,
+	provider.LangSinhala:              58,
+	provider.LangBurmese:              61,
+	provider.LangMalayalam:            64,
+}
+
+// LanguageID returns the numeric id subscene uses for l in its language filter.
+func LanguageID(l Language) (int, bool) {
+	id, ok := languageIDs[l]
+	return id, ok
+}
+
+// HIMode controls subscene's hearing impaired filter.
+type HIMode int
+
+const (
+	HIAny HIMode = iota
+	HIExclude
+	HIOnly
+)
+
+func (h HIMode) cookie() string {
+	switch h {
+	case HIExclude:
+		return "0"
+	case HIOnly:
+		return "1"
+	}
+	return "2"
+}
+
+// WithLanguages makes subscene only list subtitles in one of the given
+// languages. Languages without a known id are ignored.
+func WithLanguages(l ...Language) Option {
+	return func(o *options) { o.langs = append(o.langs, l...) }
+}
+
+// WithHI sets the hearing impaired filter.
+func WithHI(mode HIMode) Option {
+	return func(o *options) { o.hi = mode }
+}
+
+// filterCookie returns the Cookie header for the filters. It is not built
+// with http.Cookie, which quotes the comma separated language ids.
+func filterCookie(langs []Language, hi HIMode) string {
+	cookies := make([]string, 0, 2)
+	ids := make([]string, 0, len(langs))
+	for _, l := range langs {
+		if id, ok := LanguageID(l); ok {
+			ids = append(ids, strconv.Itoa(id))
+		}
+	}
+	if len(ids) != 0 {
+		cookies = append(cookies, "LanguageFilter="+strings.Join(ids, ","))
+	}
+	if hi != HIAny {
+		cookies = append(cookies, "HearingImpaired="+hi.cookie())
+	}
+
+	return strings.Join(cookies, "; ")
+}
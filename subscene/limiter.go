@@ -0,0 +1,78 @@
+package subscene
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errLimiterClosed = errors.New("limiter closed")
+
+// Limiter hands out at most burst requests at once and refills one slot
+// every interval, an interval <= 0 means no limit. A single Limiter can be
+// shared between several APIs.
+type Limiter struct {
+	c    chan struct{}
+	quit chan struct{}
+	once sync.Once
+}
+
+func NewLimiter(interval time.Duration, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l := &Limiter{quit: make(chan struct{})}
+	if interval <= 0 {
+		return l
+	}
+
+	l.c = make(chan struct{}, burst)
+	for i := 0; i < burst; i++ {
+		l.c <- struct{}{}
+	}
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-l.quit:
+				return
+			case <-t.C:
+				select {
+				case l.c <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return l
+}
+
+func (l *Limiter) Wait(ctx context.Context) error {
+	select {
+	case <-l.quit:
+		return errLimiterClosed
+	default:
+	}
+	if l.c == nil {
+		return nil
+	}
+
+	select {
+	case <-l.c:
+		return nil
+	case <-l.quit:
+		return errLimiterClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) Close() error {
+	l.once.Do(func() { close(l.quit) })
+	return nil
+}
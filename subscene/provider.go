@@ -0,0 +1,29 @@
+package subscene
+
+import (
+	"context"
+
+	"github.com/frizinak/subscene/provider"
+)
+
+type apiProvider struct{ api *API }
+
+// Provider returns api as a provider.Provider.
+func (api *API) Provider() provider.Provider { return apiProvider{api} }
+
+func (p apiProvider) Search(ctx context.Context, query string) (SearchResults, error) {
+	return p.api.SearchContext(ctx, query)
+}
+
+func (p apiProvider) List(ctx context.Context, r *SearchResult) (Downloads, error) {
+	return p.api.SubtitlesContext(ctx, r)
+}
+
+func (p apiProvider) Fetch(ctx context.Context, d *Download, dir, name string) ZipInfo {
+	uri, err := p.api.DownloadURIContext(ctx, d)
+	if err != nil {
+		return ZipInfo{URI: d.URI, Err: err}
+	}
+
+	return p.api.download(ctx, uri, dir, name, d.Lang)
+}
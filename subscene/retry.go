@@ -0,0 +1,168 @@
+package subscene
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy describes how failed requests are retried.
+// Delays grow exponentially from Base up to Max, 0 meaning no cap, with
+// random jitter. A Retry-After header sent by the server takes precedence
+// but is capped at Max as well.
+type RetryPolicy struct {
+	Retries int
+	Base    time.Duration
+	Max     time.Duration
+	// MaxWait caps the total time spent waiting between attempts, 0 means
+	// no limit.
+	MaxWait time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Retries: 30,
+	Base:    time.Millisecond * 500,
+	Max:     time.Second * 30,
+	MaxWait: time.Minute * 5,
+}
+
+// WithRetryPolicy overrides DefaultRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) { o.retry = p }
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Base
+	for i := 0; i < attempt && d < math.MaxInt64/2 && (p.Max <= 0 || d < p.Max); i++ {
+		d *= 2
+	}
+	if d = p.clamp(d); d <= 0 {
+		return 0
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (p RetryPolicy) clamp(d time.Duration) time.Duration {
+	if p.Max > 0 && d > p.Max {
+		return p.Max
+	}
+	return d
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusConflict,
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func retryableErr(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// do performs the request returned by newReq until it either succeeds,
+// fails with a non-retryable error or the retry policy is exhausted.
+// The caller is responsible for closing the body of the returned response.
+func (api *API) do(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := api.doReq(ctx, req)
+		var delay time.Duration
+		switch {
+		case err != nil:
+			if !retryableErr(err) || attempt >= api.retry.Retries {
+				return nil, err
+			}
+			delay = api.retry.backoff(attempt)
+		case retryableStatus(res.StatusCode):
+			_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1024*64))
+			res.Body.Close()
+			if attempt >= api.retry.Retries {
+				return nil, statusErr(res)
+			}
+			var ok bool
+			if delay, ok = retryAfter(res); ok {
+				delay = api.retry.clamp(delay)
+			} else {
+				delay = api.retry.backoff(attempt)
+			}
+		case res.StatusCode != http.StatusOK:
+			res.Body.Close()
+			return nil, statusErr(res)
+		default:
+			return res, nil
+		}
+
+		if api.retry.MaxWait > 0 && waited+delay > api.retry.MaxWait {
+			if err != nil {
+				return nil, err
+			}
+			return nil, statusErr(res)
+		}
+
+		waited += delay
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
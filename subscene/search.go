@@ -1,54 +1,46 @@
 package subscene
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/frizinak/subscene/provider"
 )
 
 var intRE = regexp.MustCompile(`\d+`)
 
-type SearchResults []*SearchResult
-
-func (s SearchResults) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+type (
+	SearchResults = provider.SearchResults
+	SearchResult  = provider.SearchResult
+)
 
-type SearchResult struct {
-	URI   *url.URL
-	Title string
-	Subs  int
+func (api *API) Search(query string) (SearchResults, error) {
+	return api.SearchContext(context.Background(), query)
 }
 
-func (s *SearchResult) String() string { return s.Title }
-
-func (api *API) Search(query string, retries int) (SearchResults, error) {
-	req, err := http.NewRequest(
-		"POST",
-		uri("subtitles", "searchbytitle").String(),
-		queryBody(url.Values{"query": []string{query}}),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	res, err := api.doReq(req)
+func (api *API) SearchContext(ctx context.Context, query string) (SearchResults, error) {
+	res, err := api.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			"POST",
+			api.uri("subtitles", "searchbytitle").String(),
+			queryBody(url.Values{"query": []string{query}}),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
 
-	retry, err := shouldRetry(res, retries)
-	if err != nil {
-		return nil, err
-	}
-	if retry {
-		return api.Search(query, retries-1)
-	}
-
 	doc, err := goquery.NewDocumentFromReader(res.Body)
 	if err != nil {
 		return nil, err
@@ -63,14 +55,13 @@ func (api *API) Search(query string, retries int) (SearchResults, error) {
 			return
 		}
 
-		uri, err := href(hr)
+		uri, err := api.href(hr)
 		if err != nil {
 			return
 		}
 
-		count := intRE.FindString(s.Find(".count").Text())
-		subs, _ := strconv.Atoi(count)
-		results = append(results, &SearchResult{uri, title, subs})
+		subs := atoi(s.Find(".count").Text())
+		results = append(results, &SearchResult{URI: uri, Title: title, Subs: subs})
 	})
 
 	return results, nil
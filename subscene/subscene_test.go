@@ -0,0 +1,329 @@
+package subscene_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frizinak/subscene/archive"
+	"github.com/frizinak/subscene/provider"
+	"github.com/frizinak/subscene/subscene"
+	"github.com/frizinak/subscene/subscene/subscenetest"
+	"github.com/frizinak/subscene/subtitle"
+)
+
+func testAPI(t *testing.T, opts ...subscene.Option) (*subscene.API, *subscenetest.Server) {
+	t.Helper()
+	srv := subscenetest.NewServer()
+	opts = append([]subscene.Option{
+		subscene.WithBaseURL(srv.BaseURL()),
+		subscene.WithRate(time.Millisecond, 10),
+		subscene.WithRetryPolicy(subscene.RetryPolicy{
+			Retries: 3,
+			Base:    time.Millisecond,
+			Max:     time.Millisecond * 5,
+		}),
+	}, opts...)
+	api := subscene.New(nil, opts...)
+	t.Cleanup(func() {
+		api.Close()
+		srv.Close()
+	})
+
+	return api, srv
+}
+
+func title(t *testing.T, api *subscene.API) *subscene.Title {
+	t.Helper()
+	res, err := api.Provider().Search(context.Background(), "breaking bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt, err := api.Title(res[0].URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tt
+}
+
+func TestSearch(t *testing.T) {
+	api, _ := testAPI(t)
+	res, err := api.Search("breaking bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(res))
+	}
+	if res[0].Title != "Breaking Bad - First Season (2008)" {
+		t.Errorf("unexpected title %q", res[0].Title)
+	}
+	if res[0].URI.Path != subscenetest.TitlePath {
+		t.Errorf("unexpected uri %s", res[0].URI)
+	}
+	if res[2].Subs != 1024 {
+		t.Errorf("expected 1024 subs, got %d", res[2].Subs)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	api, _ := testAPI(t)
+	tt := title(t, api)
+
+	if tt.Name != "Breaking Bad - First Season" {
+		t.Errorf("unexpected name %q", tt.Name)
+	}
+	if tt.Year != 2008 || tt.Season != 1 {
+		t.Errorf("unexpected year/season %d/%d", tt.Year, tt.Season)
+	}
+	if tt.IMDbID != "tt0903747" {
+		t.Errorf("unexpected imdb id %q", tt.IMDbID)
+	}
+	if tt.Poster == nil || tt.Poster.Host != "i.jeded.com" {
+		t.Errorf("unexpected poster %v", tt.Poster)
+	}
+
+	if len(tt.Downloads) != 3 {
+		t.Fatalf("expected 3 downloads, got %d", len(tt.Downloads))
+	}
+	dl := tt.Downloads[1]
+	if dl.Title != "Breaking.Bad.S01E02.720p.BluRay" || !dl.HI || dl.Lang != "english" {
+		t.Errorf("unexpected download %+v", dl)
+	}
+	if tt.Downloads[2].Lang != "dutch" || tt.Downloads[0].HI {
+		t.Errorf("unexpected language or hi flag")
+	}
+
+	if len(tt.Seasons) != 1 || tt.Seasons[0].Number != 1 || len(tt.Seasons[0].Downloads) != 3 {
+		t.Errorf("unexpected seasons %+v", tt.Seasons)
+	}
+}
+
+func TestDetail(t *testing.T) {
+	api, _ := testAPI(t)
+	tt := title(t, api)
+
+	d, err := api.Detail(tt.Downloads[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Releases) != 2 || d.Releases[1] != "Breaking.Bad.S01E01.1080p.BluRay.x264-ROVERS" {
+		t.Errorf("unexpected releases %v", d.Releases)
+	}
+	if d.Rating != 9 || d.Votes != 12 || d.Downloads != 1234 {
+		t.Errorf("unexpected rating/votes/downloads %d/%d/%d", d.Rating, d.Votes, d.Downloads)
+	}
+	if d.Uploader != "jdoe" || d.UploaderURI.Path != "/u/1" {
+		t.Errorf("unexpected uploader %q %v", d.Uploader, d.UploaderURI)
+	}
+	if d.Notes != "Synced and corrected" || d.HI {
+		t.Errorf("unexpected notes/hi %q/%v", d.Notes, d.HI)
+	}
+	if !d.Uploaded.Equal(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected upload date %s", d.Uploaded)
+	}
+	if d.DownloadURI == nil || d.DownloadURI.Path != "/subtitles/english-text/breaking-bad-s01e01.zip" {
+		t.Errorf("unexpected download uri %v", d.DownloadURI)
+	}
+
+	_, err = api.DownloadURI(tt.Downloads[2])
+	if !errors.Is(err, subscene.ErrNoDownloadLink) {
+		t.Errorf("expected ErrNoDownloadLink, got %v", err)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	api, _ := testAPI(t)
+	_, err := api.SubtitlePage("does-not-exist")
+	if !errors.Is(err, subscene.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	var herr *subscene.HTTPError
+	if !errors.As(err, &herr) || herr.StatusCode != 404 {
+		t.Fatalf("expected *HTTPError, got %v", err)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	api, srv := testAPI(t)
+	srv.Throttle(2)
+	if _, err := api.Search("breaking bad"); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+
+	srv.Throttle(10)
+	_, err := api.Search("breaking bad")
+	if !errors.Is(err, subscene.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	// Without Max the delays keep growing: at least 5+10+20ms.
+	api, srv := testAPI(t, subscene.WithRetryPolicy(subscene.RetryPolicy{
+		Retries: 3,
+		Base:    10 * time.Millisecond,
+	}))
+	srv.Throttle(3)
+	start := time.Now()
+	if _, err := api.Search("breaking bad"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 35*time.Millisecond {
+		t.Errorf("delays did not grow without Max, waited %s", d)
+	}
+
+	// Retry-After is capped at Max.
+	api, srv = testAPI(t)
+	srv.Throttle(1)
+	srv.RetryAfter(3600)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := api.SearchContext(ctx, "breaking bad"); err != nil {
+		t.Fatalf("Retry-After was not capped: %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	api, srv := testAPI(t)
+	srv.Throttle(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := api.SearchContext(ctx, "breaking bad")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestGet(t *testing.T) {
+	api, _ := testAPI(t)
+	tt := title(t, api)
+	dir := t.TempDir()
+
+	var infos []subscene.ZipInfo
+	err := api.Get(tt.Downloads, dir, "", func(z subscene.ZipInfo) {
+		infos = append(infos, z)
+	})
+
+	var errs subscene.Errors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected a single failure, got %v", err)
+	}
+	var derr *subscene.DownloadError
+	if !errors.As(errs[0], &derr) || derr.Download != tt.Downloads[2] {
+		t.Errorf("expected failure for %s, got %v", tt.Downloads[2], errs[0])
+	}
+	if !errors.Is(err, subscene.ErrNoDownloadLink) {
+		t.Errorf("expected ErrNoDownloadLink, got %v", err)
+	}
+
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 callbacks, got %d", len(infos))
+	}
+
+	for _, name := range []string{
+		"Breaking.Bad.S01E01.720p.BluRay.srt",
+		"Breaking.Bad.S01E02.720p.BluRay.srt",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "readme.txt")); err == nil {
+		t.Error("non subtitle file was extracted")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	api, _ := testAPI(t, subscene.WithConvert(subtitle.VTT, true))
+	tt := title(t, api)
+	dir := t.TempDir()
+
+	u, err := api.DownloadURI(tt.Downloads[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := api.Download(u, dir, "")
+	if z.Err != nil {
+		t.Fatal(z.Err)
+	}
+
+	vtt := filepath.Join(dir, "Breaking.Bad.S01E01.720p.BluRay.vtt")
+	if len(z.Converted) != 1 {
+		t.Fatalf("expected a single conversion, got %+v", z.Converted)
+	}
+	for k, c := range z.Converted {
+		if c.Path != vtt || z.Extracted[k].Path != vtt {
+			t.Errorf("expected %s to be replaced by %s, got %+v", k, vtt, c)
+		}
+	}
+	if _, err := os.Stat(strings.TrimSuffix(vtt, ".vtt") + ".srt"); err == nil {
+		t.Error("original was not removed")
+	}
+	if b, err := os.ReadFile(vtt); err != nil || !strings.HasPrefix(string(b), "WEBVTT") {
+		t.Errorf("unexpected vtt %q %v", b, err)
+	}
+
+	api, _ = testAPI(t, subscene.WithConvert(subtitle.VTT, true))
+	dir = t.TempDir()
+	vtt = filepath.Join(dir, filepath.Base(vtt))
+	if err := os.WriteFile(vtt, []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	z = api.Download(u, dir, "")
+	if len(z.Converted) != 1 {
+		t.Fatalf("expected a single conversion, got %+v", z.Converted)
+	}
+	for k, c := range z.Converted {
+		if c.Path != "" || !c.Existed || c.Policy != archive.Skip || z.Extracted[k].Path == vtt {
+			t.Errorf("expected the existing %s to be skipped, got %+v", vtt, c)
+		}
+	}
+	if b, _ := os.ReadFile(vtt); string(b) != "mine" {
+		t.Errorf("existing vtt was overwritten: %q", b)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := subscene.NewLimiter(0, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 10; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("expected an error from a closed limiter")
+	}
+
+	api, _ := testAPI(t, subscene.WithRate(-time.Second, 1))
+	title(t, api)
+}
+
+func TestFilterCookie(t *testing.T) {
+	api, srv := testAPI(t,
+		subscene.WithLanguages(provider.LangEnglish, provider.LangDutch, "klingon"),
+		subscene.WithHI(subscene.HIExclude),
+	)
+	title(t, api)
+	if c := srv.Cookie(); c != "LanguageFilter=13,11; HearingImpaired=0" {
+		t.Errorf("unexpected Cookie header %q", c)
+	}
+
+	api, srv = testAPI(t)
+	title(t, api)
+	if c := srv.Cookie(); c != "" {
+		t.Errorf("unexpected Cookie header %q", c)
+	}
+}
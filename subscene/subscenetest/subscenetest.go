@@ -0,0 +1,150 @@
+// Package subscenetest serves recorded subscene pages and downloads so the
+// scraper can be tested offline.
+package subscenetest
+
+import (
+	"embed"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+const (
+	TitlePath    = "/subtitles/breaking-bad-first-season"
+	ZipDetail    = TitlePath + "/english/1001"
+	RarDetail    = TitlePath + "/english/1002"
+	NoLinkDetail = TitlePath + "/dutch/1003"
+)
+
+var downloads = map[string]string{
+	"breaking-bad-s01e01.zip": "application/x-zip-compressed",
+	"breaking-bad-s01e02.rar": "application/x-rar-compressed",
+}
+
+// Server is an httptest.Server that mimics subscene.com.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	throttle   int
+	retryAfter int
+	requests   int
+	cookie     string
+}
+
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// BaseURL returns the url to pass to subscene.WithBaseURL.
+func (s *Server) BaseURL() *url.URL {
+	u, _ := url.Parse(s.URL)
+	return u
+}
+
+// Throttle makes the next n requests fail with 409 Conflict
+// the way subscene does when it is being hammered.
+func (s *Server) Throttle(n int) {
+	s.mu.Lock()
+	s.throttle = n
+	s.mu.Unlock()
+}
+
+// RetryAfter makes throttled responses ask to retry after the given number
+// of seconds.
+func (s *Server) RetryAfter(seconds int) {
+	s.mu.Lock()
+	s.retryAfter = seconds
+	s.mu.Unlock()
+}
+
+// Requests returns the number of requests served so far.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Cookie returns the raw Cookie header of the last request.
+func (s *Server) Cookie() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cookie
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	s.cookie = r.Header.Get("Cookie")
+	throttled := s.throttle > 0
+	if throttled {
+		s.throttle--
+	}
+	retryAfter := s.retryAfter
+	s.mu.Unlock()
+
+	if throttled {
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+		http.Error(w, "Conflict", http.StatusConflict)
+		return
+	}
+
+	switch p := path.Clean(r.URL.Path); {
+	case p == "/subtitles/searchbytitle":
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		html(w, "search.html")
+	case p == TitlePath:
+		html(w, "title.html")
+	case p == ZipDetail:
+		html(w, "detail-1001.html")
+	case p == RarDetail:
+		html(w, "detail-1002.html")
+	case p == NoLinkDetail:
+		html(w, "detail-1003.html")
+	case path.Dir(p) == "/subtitles/english-text":
+		name := path.Base(p)
+		mime, ok := downloads[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		file(w, name, mime)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func html(w http.ResponseWriter, name string) {
+	b, err := fixtures.ReadFile("fixtures/" + name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(b)
+}
+
+func file(w http.ResponseWriter, name, mime string) {
+	b, err := fixtures.ReadFile("fixtures/" + name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mime)
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	_, _ = w.Write(b)
+}
@@ -1,133 +1,91 @@
 package subscene
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"mime"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/frizinak/subscene/archive"
+	"github.com/frizinak/subscene/charset"
+	"github.com/frizinak/subscene/provider"
+	"github.com/frizinak/subscene/subtitle"
 )
 
-type Downloads []*Download
+// SubtitleExts are the extensions of the files Download extracts by default.
+var SubtitleExts = []string{".srt", ".ass", ".ssa", ".sub", ".idx", ".vtt", ".smi"}
 
-func (d Downloads) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+type extensions map[string]struct{}
 
-func (d Downloads) FilterLanguage(l Language) Downloads {
-	dls := make(Downloads, 0, len(d))
-	for _, dl := range d {
-		if dl.Lang == l {
-			dls = append(dls, dl)
+func newExtensions(exts []string) extensions {
+	m := make(extensions, len(exts))
+	for _, ext := range exts {
+		if ext != "" && ext[0] != '.' {
+			ext = "." + ext
 		}
+		m[strings.ToLower(ext)] = struct{}{}
 	}
-
-	return dls
+	return m
 }
 
-func (d Downloads) FilterN(n ...int) Downloads {
-	dls := make(Downloads, 0, len(n))
-	for _, ix := range n {
-		if ix < 0 || ix >= len(d) {
-			panic("out of bounds")
-		}
-		dls = append(dls, d[ix])
-	}
-
-	return dls
+func (e extensions) filter(name string) bool {
+	_, ok := e[strings.ToLower(filepath.Ext(name))]
+	return ok
 }
 
-type Download struct {
-	Lang    Language
-	URI     *url.URL
-	Title   string
-	Author  string
-	Comment string
-	HI      bool
-}
+var vobsub = []byte{0, 0, 1, 0xba}
 
-func (s *Download) String() string { return s.Title }
-
-type Language string
-
-const (
-	LangEnglish              Language = "english"
-	LangDutch                Language = "dutch"
-	LangArabic               Language = "arabic"
-	LangBengali              Language = "bengali"
-	LangBig_5_code           Language = "big_5_code"
-	LangBrazillianPortuguese Language = "brazillian"
-	LangBurmese              Language = "burmese"
-	LangChinese              Language = "chinese"
-	LangCroatian             Language = "croatian"
-	LangDanish               Language = "danish"
-	LangEstonian             Language = "estonian"
-	LangFarsi_persian        Language = "farsi_persian"
-	LangFinnish              Language = "finnish"
-	LangFrench               Language = "french"
-	LangGerman               Language = "german"
-	LangGreek                Language = "greek"
-	LangHebrew               Language = "hebrew"
-	LangIndonesian           Language = "indonesian"
-	LangItalian              Language = "italian"
-	LangJapanese             Language = "japanese"
-	LangKorean               Language = "korean"
-	LangLatvian              Language = "latvian"
-	LangLithuanian           Language = "lithuanian"
-	LangMalay                Language = "malay"
-	LangMalayalam            Language = "malayalam"
-	LangNorwegian            Language = "norwegian"
-	LangPolish               Language = "polish"
-	LangPortuguese           Language = "portuguese"
-	LangRussian              Language = "russian"
-	LangSerbian              Language = "serbian"
-	LangSinhala              Language = "sinhala"
-	LangSlovenian            Language = "slovenian"
-	LangSpanish              Language = "spanish"
-	LangSwedish              Language = "swedish"
-	LangThai                 Language = "thai"
-	LangTurkish              Language = "turkish"
-	LangVietnamese           Language = "vietnamese"
-)
+// maxUTF8Size is the size up to which subtitles are converted to UTF-8,
+// anything larger is not buffered in memory and left alone.
+const maxUTF8Size = 1024 * 1024 * 8
 
-func (api *API) subtitlePage(u *url.URL, retries int) (Downloads, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
-	if err != nil {
-		return nil, err
-	}
+func toUTF8(hint Language) archive.Transform {
+	return func(name string, r io.Reader) (io.Reader, string, error) {
+		b, err := io.ReadAll(io.LimitReader(r, maxUTF8Size+1))
+		if err != nil {
+			return nil, "", err
+		}
+		if len(b) > maxUTF8Size || bytes.HasPrefix(b, vobsub) {
+			return io.MultiReader(bytes.NewReader(b), r), "", nil
+		}
 
-	res, err := api.doReq(req)
-	if err != nil {
-		return nil, err
+		b, enc, err := charset.ToUTF8(b, hint)
+		return bytes.NewReader(b), enc, err
 	}
-	defer res.Body.Close()
+}
 
-	retry, err := shouldRetry(res, retries)
-	if err != nil {
-		return nil, err
-	}
-	if retry {
-		return api.subtitlePage(u, retries-1)
-	}
+type (
+	Downloads = provider.Downloads
+	Download  = provider.Download
+	Language  = provider.Language
+	ZipInfo   = provider.ZipInfo
+)
 
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+func (api *API) subtitlePage(ctx context.Context, u *url.URL) (Downloads, error) {
+	t, err := api.TitleContext(ctx, u)
 	if err != nil {
 		return nil, err
 	}
 
+	return t.Downloads, nil
+}
+
+func (api *API) parseDownloads(doc *goquery.Document) Downloads {
 	dls := make(Downloads, 0, 100)
 	doc.Find(".a1 a").Each(func(i int, s *goquery.Selection) {
 		hr, ok := s.Attr("href")
 		if !ok {
 			return
 		}
-		uri, err := href(hr)
+		uri, err := api.href(hr)
 		if err != nil {
 			return
 		}
@@ -138,147 +96,163 @@ func (api *API) subtitlePage(u *url.URL, retries int) (Downloads, error) {
 		author := pp.Find(".a5").Text()
 		comment := pp.Find(".a6").Text()
 		hi := pp.Find(".a41").Length() != 0
-		dls = append(dls, &Download{lang, uri, text, author, comment, hi})
+		dls = append(dls, &Download{
+			Lang:    lang,
+			URI:     uri,
+			Title:   text,
+			Author:  author,
+			Comment: comment,
+			HI:      hi,
+		})
 	})
 
-	return dls, err
+	return dls
 }
 
-func (api *API) Subtitles(r *SearchResult, retries int) (Downloads, error) {
-	return api.subtitlePage(r.URI, retries)
+func (api *API) Subtitles(r *SearchResult) (Downloads, error) {
+	return api.SubtitlesContext(context.Background(), r)
 }
 
-func (api *API) SubtitlePage(path string, retries int) (Downloads, error) {
-	return api.subtitlePage(uri("subtitles", path), retries)
+func (api *API) SubtitlesContext(ctx context.Context, r *SearchResult) (Downloads, error) {
+	return api.subtitlePage(ctx, r.URI)
 }
 
-func (api *API) DownloadURI(d *Download, retries int) (*url.URL, error) {
-	req, err := http.NewRequest("GET", d.URI.String(), nil)
-	if err != nil {
-		return nil, err
-	}
+func (api *API) SubtitlePage(path string) (Downloads, error) {
+	return api.SubtitlePageContext(context.Background(), path)
+}
 
-	res, err := api.doReq(req)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
+func (api *API) SubtitlePageContext(ctx context.Context, path string) (Downloads, error) {
+	return api.subtitlePage(ctx, api.uri("subtitles", path))
+}
 
-	retry, err := shouldRetry(res, retries)
-	if err != nil {
-		return nil, err
-	}
-	if retry {
-		return api.DownloadURI(d, retries-1)
-	}
+func (api *API) DownloadURI(d *Download) (*url.URL, error) {
+	return api.DownloadURIContext(context.Background(), d)
+}
 
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+func (api *API) DownloadURIContext(ctx context.Context, d *Download) (*url.URL, error) {
+	detail, err := api.DetailContext(ctx, d)
 	if err != nil {
 		return nil, err
 	}
-
-	hr, ok := doc.Find(".download a").Attr("href")
-	if !ok {
-		return nil, errors.New("missing download link")
+	if detail.DownloadURI == nil {
+		return nil, ErrNoDownloadLink
 	}
 
-	return href(hr)
+	return detail.DownloadURI, nil
+}
+
+func (api *API) Download(u *url.URL, dir, name string) ZipInfo {
+	return api.DownloadContext(context.Background(), u, dir, name)
 }
 
-type ZipInfo struct {
-	URI       *url.URL
-	Filename  string
-	Extracted map[string]string
-	Err       error
+// DownloadContext downloads the archive at u and extracts its subtitles.
+// The first language passed to WithLanguages is used as a hint when
+// converting to UTF-8, see WithUTF8.
+func (api *API) DownloadContext(ctx context.Context, u *url.URL, dir, name string) ZipInfo {
+	var lang Language
+	if len(api.langs) != 0 {
+		lang = api.langs[0]
+	}
+
+	return api.download(ctx, u, dir, name, lang)
 }
 
-func (api *API) Download(u *url.URL, dir, name string, retries int) ZipInfo {
+func (api *API) download(ctx context.Context, u *url.URL, dir, name string, lang Language) ZipInfo {
 	var z ZipInfo
 	z.URI = u
 
-	req, err := http.NewRequest("GET", u.String(), nil)
-	if err != nil {
-		z.Err = err
-		return z
-	}
-
-	res, err := api.doReq(req)
+	res, err := api.do(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	})
 	if err != nil {
 		z.Err = err
 		return z
 	}
 	defer res.Body.Close()
 
-	retry, err := shouldRetry(res, retries)
-	if err != nil {
-		z.Err = err
-		return z
-	}
-	if retry {
-		return api.Download(u, dir, name, retries-1)
-	}
-
 	_, params, _ := mime.ParseMediaType(res.Header.Get("Content-Disposition"))
 	if v, ok := params["filename"]; ok {
 		z.Filename = v
 	}
 
-	size, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
-	if err != nil {
-		z.Err = err
-		return z
-	}
-	if size > 1024*1024*80 {
-		z.Err = errors.New("body too large")
-		return z
-	}
-
-	mtype, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
-	arch, err := archive.NewReader(mtype, io.LimitReader(res.Body, size), size)
+	arch, err := archive.NewReader(res.Body, res.ContentLength, z.Filename, archive.ReaderOptions{
+		MaxSize:      api.maxSize,
+		Password:     api.password,
+		PasswordFunc: api.askPassword,
+	})
 	if err != nil {
 		z.Err = err
 		return z
 	}
+	defer arch.Close()
 
 	dest := dir
 	if name != "" {
-		dest = filepath.Join(dest, name) + ".srt"
+		dest = filepath.Join(dest, name)
 	}
 
-	z.Extracted, z.Err = arch.Extract(dest, func(f string) bool {
-		return filepath.Ext(f) == ".srt"
-	})
+	opts := archive.Options{
+		Filter:  api.exts.filter,
+		Depth:   api.nestedDepth,
+		MaxSize: api.nestedSize,
+		KeepExt: true,
+		Policy:  api.policy,
+	}
+	if api.utf8 {
+		opts.Transform = toUTF8(lang)
+	}
+
+	z.Extracted, z.Err = arch.Extract(dest, opts)
+	if api.convert != "" {
+		z.Converted = api.convertAll(z.Extracted)
+	}
 
 	_, _ = io.Copy(io.Discard, res.Body)
 
 	return z
 }
 
-func (api *API) Get(d Downloads, dir, name string, retries int, cb func(ZipInfo)) error {
-	var gerr error
-	var wg sync.WaitGroup
-	for _, dl := range d {
-		wg.Add(1)
-		go func(dl *Download) {
-			defer wg.Done()
-			uri, err := api.DownloadURI(dl, retries)
-			if err != nil {
-				gerr = err
-				return
-			}
-
-			z := api.Download(uri, dir, name, retries)
-			if cb != nil {
-				cb(z)
-			}
+// convertAll converts all extracted subtitles that are not yet in the
+// requested format. Existing files are handled according to WithOverwrite.
+func (api *API) convertAll(files map[string]archive.Result) map[string]archive.Result {
+	converted := make(map[string]archive.Result)
+	for k, r := range files {
+		if r.Path == "" || subtitle.FormatOf(r.Path) == api.convert {
+			continue
+		}
+		buf := bytes.NewBuffer(nil)
+		err := subtitle.ConvertTo(buf, r.Path, api.convert)
+		if errors.Is(err, subtitle.ErrFormat) {
+			continue
+		}
+		if err != nil {
+			converted[k] = archive.Result{Err: err}
+			continue
+		}
 
-			if z.Err != nil {
-				gerr = z.Err
-				return
+		fn := strings.TrimSuffix(r.Path, filepath.Ext(r.Path)) + api.convert.Ext()
+		c, err := archive.WriteFile(fn, buf, api.policy)
+		if err != nil {
+			c.Err = err
+		}
+		converted[k] = c
+		if api.replace && c.Path != "" {
+			if err := os.Remove(r.Path); err == nil {
+				r.Path = c.Path
+				files[k] = r
 			}
-		}(dl)
+		}
 	}
 
-	wg.Wait()
-	return gerr
+	return converted
+}
+
+func (api *API) Get(d Downloads, dir, name string, cb func(ZipInfo)) error {
+	return api.GetContext(context.Background(), d, dir, name, cb)
+}
+
+// GetContext downloads and extracts d, at most api's concurrency limit at a
+// time. See provider.Get.
+func (api *API) GetContext(ctx context.Context, d Downloads, dir, name string, cb func(ZipInfo)) error {
+	return provider.Get(ctx, api.Provider(), d, dir, name, api.concurrency, cb)
 }
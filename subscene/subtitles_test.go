@@ -0,0 +1,26 @@
+package subscene
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestToUTF8Limit(t *testing.T) {
+	latin1 := "caf\xe9\n"
+	_, enc, err := toUTF8("french")("a.srt", strings.NewReader(latin1))
+	if err != nil || enc == "" || enc == "utf-8" {
+		t.Errorf("expected a small file to be converted, got %q %v", enc, err)
+	}
+
+	big := strings.Repeat(latin1, maxUTF8Size/len(latin1)+1)
+	r, enc, err := toUTF8("french")("a.srt", strings.NewReader(big))
+	if err != nil || enc != "" {
+		t.Fatalf("expected a large file to be left alone, got %q %v", enc, err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(b, []byte(big)) {
+		t.Errorf("large file changed: %d bytes, %v", len(b), err)
+	}
+}
@@ -0,0 +1,146 @@
+package subscene
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	imdbIDRE        = regexp.MustCompile(`tt\d+`)
+	yearRE          = regexp.MustCompile(`(?:19|20)\d{2}`)
+	releaseSeasonRE = regexp.MustCompile(`(?i)\bs(\d{1,2})[ .]?e\d{1,3}|\bseason[ .]?(\d{1,2})\b|\b(\d{1,2})x\d{2}\b`)
+	titleSeasonRE   = regexp.MustCompile(`(?i)\b(\w+) season\b`)
+)
+
+var ordinals = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5,
+	"sixth": 6, "seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+	"eleventh": 11, "twelfth": 12, "thirteenth": 13, "fourteenth": 14,
+	"fifteenth": 15, "sixteenth": 16, "seventeenth": 17, "eighteenth": 18,
+	"nineteenth": 19, "twentieth": 20,
+}
+
+// Title is a film or a season of a show as listed on its subscene page.
+type Title struct {
+	URI    *url.URL
+	Name   string
+	Year   int
+	Poster *url.URL
+	IMDb   *url.URL
+	IMDbID string
+	// Season is the season this page is for as derived from its name,
+	// 0 for films or when unknown.
+	Season    int
+	Downloads Downloads
+	// Seasons groups Downloads by the season their release name refers to,
+	// sorted by season number. Downloads without a recognizable season end
+	// up in the season of the page itself.
+	Seasons []Season
+}
+
+type Season struct {
+	Number    int
+	Downloads Downloads
+}
+
+func (t *Title) String() string { return t.Name }
+
+func (api *API) Title(u *url.URL) (*Title, error) {
+	return api.TitleContext(context.Background(), u)
+}
+
+func (api *API) TitleContext(ctx context.Context, u *url.URL) (*Title, error) {
+	res, err := api.do(ctx, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Title{URI: u}
+	header := doc.Find(".top .header").First()
+	h := header.Find("h2").First().Clone()
+	h.Find("a").Remove()
+	t.Name = strings.TrimSpace(h.Text())
+
+	header.Find("li").Each(func(i int, s *goquery.Selection) {
+		label := strings.ToLower(s.Find("strong").Text())
+		if strings.Contains(label, "year") {
+			t.Year, _ = strconv.Atoi(yearRE.FindString(s.Text()))
+		}
+	})
+
+	if src, ok := doc.Find(".top .poster img").Attr("src"); ok {
+		t.Poster, _ = api.href(src)
+	}
+
+	if hr, ok := header.Find("a.imdb").Attr("href"); ok {
+		if u, err := url.Parse(hr); err == nil {
+			t.IMDb = u
+			t.IMDbID = imdbIDRE.FindString(u.Path)
+		}
+	}
+
+	if m := titleSeasonRE.FindStringSubmatch(t.Name); m != nil {
+		t.Season = ordinals[strings.ToLower(m[1])]
+		if t.Season == 0 {
+			t.Season, _ = strconv.Atoi(strings.TrimRight(m[1], "stndrh"))
+		}
+	}
+
+	t.Downloads = api.parseDownloads(doc)
+	t.Seasons = groupSeasons(t.Downloads, t.Season)
+
+	return t, nil
+}
+
+func releaseSeason(title string) (int, bool) {
+	m := releaseSeasonRE.FindStringSubmatch(title)
+	if m == nil {
+		return 0, false
+	}
+	for _, v := range m[1:] {
+		if v != "" {
+			n, err := strconv.Atoi(v)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+func groupSeasons(dls Downloads, fallback int) []Season {
+	index := make(map[int]int)
+	seasons := make([]Season, 0, 1)
+	for _, dl := range dls {
+		n, ok := releaseSeason(dl.Title)
+		if !ok {
+			n = fallback
+		}
+		ix, ok := index[n]
+		if !ok {
+			ix = len(seasons)
+			index[n] = ix
+			seasons = append(seasons, Season{Number: n})
+		}
+		seasons[ix].Downloads = append(seasons[ix].Downloads, dl)
+	}
+
+	sort.SliceStable(seasons, func(i, j int) bool {
+		return seasons[i].Number < seasons[j].Number
+	})
+
+	return seasons
+}
@@ -0,0 +1,446 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Script is a SubStation Alpha (.ssa) or Advanced SubStation Alpha (.ass)
+// script. All sections and lines are kept as they were read, including
+// comments and sections that are not understood, so writing a parsed
+// script reproduces it exactly.
+type Script struct {
+	// Sections holds the sections in order, lines before the first
+	// section header are kept in a Section without Name.
+	Sections []*Section
+
+	bom   bool
+	crlf  bool
+	noEOL bool
+}
+
+// Section is a [Name] section of a script.
+type Section struct {
+	Name  string
+	Lines []Line
+
+	header string
+}
+
+// Line is a "Key: Value" line, any other line (comments, blank lines,
+// embedded fonts) has an empty Key and is kept in Value as is.
+type Line struct {
+	Key   string
+	Value string
+
+	sep string
+}
+
+// Fields are the comma separated values of a Style, Dialogue or Comment
+// line keyed by the names in their section's Format line.
+type Fields map[string]string
+
+// Event is a Dialogue or Comment line of the [Events] section.
+type Event struct {
+	Comment    bool
+	Start, End time.Duration
+	Style      string
+	// Text is the raw text including override tags like {\an8}.
+	Text   string
+	Fields Fields
+}
+
+const (
+	sectionInfo   = "Script Info"
+	sectionStyles = "V4+ Styles"
+	sectionEvents = "Events"
+)
+
+var (
+	defaultEventFormat = "Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text"
+	defaultStyleFormat = "Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, " +
+		"Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, " +
+		"Alignment, MarginL, MarginR, MarginV, Encoding"
+	defaultStyle = "Default,Arial,20,&H00FFFFFF,&H000000FF,&H00000000,&H00000000," +
+		"0,0,0,0,100,100,0,0,1,2,2,2,10,10,10,1"
+)
+
+// rawSections hold binary data and are never split into keys and values.
+var rawSections = map[string]struct{}{"fonts": {}, "graphics": {}}
+
+// ParseASS parses an ASS or SSA script. Events with invalid timestamps are
+// reported in a ParseErrors but kept in the script.
+func ParseASS(r io.Reader) (*Script, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s := string(b)
+	a := &Script{}
+	if strings.HasPrefix(s, bom) {
+		a.bom, s = true, s[len(bom):]
+	}
+	a.crlf = strings.Contains(s, "\r\n")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	a.noEOL = s != "" && !strings.HasSuffix(s, "\n")
+
+	var lines []string
+	if s != "" {
+		lines = strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	}
+
+	var errs ParseErrors
+	sec := &Section{}
+	a.Sections = append(a.Sections, sec)
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		if strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+			sec = &Section{Name: t[1 : len(t)-1], header: l}
+			a.Sections = append(a.Sections, sec)
+			continue
+		}
+
+		line := Line{Value: l}
+		_, raw := rawSections[strings.ToLower(sec.Name)]
+		if ix := strings.IndexByte(l, ':'); !raw && ix > 0 && !strings.HasPrefix(t, ";") {
+			rest := l[ix+1:]
+			value := strings.TrimLeft(rest, " \t")
+			line = Line{l[:ix], value, ":" + rest[:len(rest)-len(value)]}
+		}
+		sec.Lines = append(sec.Lines, line)
+
+		if strings.EqualFold(sec.Name, sectionEvents) && isEvent(line.Key) {
+			if _, err := sec.event(line); err != nil {
+				errs = append(errs, &ParseError{i + 1, err.Error()})
+			}
+		}
+	}
+	if len(a.Sections[0].Lines) == 0 {
+		a.Sections = a.Sections[1:]
+	}
+
+	return a, errs.err()
+}
+
+// Write writes the script, a parsed script is written back unchanged.
+func (a *Script) Write(w io.Writer) error {
+	eol := "\n"
+	if a.crlf {
+		eol = "\r\n"
+	}
+
+	lines := make([]string, 0, 64)
+	for _, s := range a.Sections {
+		if s.Name != "" {
+			header := s.header
+			if header == "" {
+				header = "[" + s.Name + "]"
+			}
+			lines = append(lines, header)
+		}
+		for _, l := range s.Lines {
+			if l.Key == "" {
+				lines = append(lines, l.Value)
+				continue
+			}
+			sep := l.sep
+			if sep == "" {
+				sep = ": "
+			}
+			lines = append(lines, l.Key+sep+l.Value)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	if a.bom {
+		bw.WriteString(bom)
+	}
+	bw.WriteString(strings.Join(lines, eol))
+	if !a.noEOL && len(lines) != 0 {
+		bw.WriteString(eol)
+	}
+	return bw.Flush()
+}
+
+// Section returns the section with the given name, nil if there is none.
+func (a *Script) Section(name string) *Section {
+	for _, s := range a.Sections {
+		if strings.EqualFold(s.Name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Get returns the value of the first line with the given key.
+func (s *Section) Get(key string) (string, bool) {
+	for _, l := range s.Lines {
+		if strings.EqualFold(l.Key, key) {
+			return l.Value, true
+		}
+	}
+	return "", false
+}
+
+// Info returns a value from the [Script Info] section, e.g.: Title.
+func (a *Script) Info(key string) string {
+	if s := a.Section(sectionInfo); s != nil {
+		v, _ := s.Get(key)
+		return v
+	}
+	return ""
+}
+
+func (s *Section) format(def string) []string {
+	f, ok := s.Get("Format")
+	if !ok {
+		f = def
+	}
+	names := strings.Split(f, ",")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names
+}
+
+// Fields splits the value of l according to the section's Format, the last
+// field, which is the Text of an event, may contain commas.
+func (s *Section) Fields(l Line) Fields {
+	def := defaultStyleFormat
+	if strings.EqualFold(s.Name, sectionEvents) {
+		def = defaultEventFormat
+	}
+	names := s.format(def)
+	values := strings.SplitN(l.Value, ",", len(names))
+	f := make(Fields, len(names))
+	for i, v := range values {
+		if i < len(names)-1 {
+			v = strings.TrimSpace(v)
+		}
+		f[names[i]] = v
+	}
+	return f
+}
+
+func isEvent(key string) bool {
+	return strings.EqualFold(key, "Dialogue") || strings.EqualFold(key, "Comment")
+}
+
+func (s *Section) event(l Line) (Event, error) {
+	f := s.Fields(l)
+	start, err := ParseTimestamp(f["Start"])
+	if err != nil {
+		return Event{}, err
+	}
+	end, err := ParseTimestamp(f["End"])
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Comment: strings.EqualFold(l.Key, "Comment"),
+		Start:   start,
+		End:     end,
+		Style:   f["Style"],
+		Text:    f["Text"],
+		Fields:  f,
+	}, nil
+}
+
+// Styles returns all styles of the [V4+ Styles] or [V4 Styles] section.
+func (a *Script) Styles() []Fields {
+	s := a.Section(sectionStyles)
+	if s == nil {
+		s = a.Section("V4 Styles")
+	}
+	if s == nil {
+		return nil
+	}
+
+	styles := make([]Fields, 0, len(s.Lines))
+	for _, l := range s.Lines {
+		if strings.EqualFold(l.Key, "Style") {
+			styles = append(styles, s.Fields(l))
+		}
+	}
+	return styles
+}
+
+// Events returns all events with valid timestamps in the order they appear.
+func (a *Script) Events() []Event {
+	s := a.Section(sectionEvents)
+	if s == nil {
+		return nil
+	}
+
+	events := make([]Event, 0, len(s.Lines))
+	for _, l := range s.Lines {
+		if !isEvent(l.Key) {
+			continue
+		}
+		if e, err := s.event(l); err == nil {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+var (
+	overrideRE    = regexp.MustCompile(`\{[^}]*\}`)
+	overrideTagRE = regexp.MustCompile(`\\(an|a|i|b|u|p)(\d+)`)
+
+	// legacyAlign maps SSA \a alignments to ASS' numpad layout.
+	legacyAlign = map[int]int{1: 1, 2: 2, 3: 3, 5: 7, 6: 8, 7: 9, 9: 4, 10: 5, 11: 6}
+
+	assText = strings.NewReplacer(`\N`, "\n", `\n`, " ", `\h`, " ")
+)
+
+// srtText converts the text of an event to SRT lines. Italic, bold and
+// underline overrides become tags, a non default alignment is kept as
+// {\anN} which most players understand, all other overrides are
+// stripped. Drawings are dropped entirely.
+func srtText(text string) []string {
+	var align int
+	var drawing bool
+	text = overrideRE.ReplaceAllStringFunc(text, func(block string) string {
+		var tags string
+		for _, m := range overrideTagRE.FindAllStringSubmatch(block, -1) {
+			n, _ := strconv.Atoi(m[2])
+			switch m[1] {
+			case "an":
+				align = n
+			case "a":
+				align = legacyAlign[n]
+			case "p":
+				drawing = drawing || n > 0
+			case "b":
+				if n == 1 || n >= 600 {
+					tags += "<b>"
+					continue
+				}
+				tags += "</b>"
+			default:
+				if n == 0 {
+					tags += "</" + m[1] + ">"
+					continue
+				}
+				tags += "<" + m[1] + ">"
+			}
+		}
+		return tags
+	})
+	if drawing {
+		return nil
+	}
+
+	lines := make([]string, 0, 2)
+	for _, l := range strings.Split(assText.Replace(text), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) != 0 && align > 0 && align != 2 {
+		lines[0] = fmt.Sprintf(`{\an%d}`, align) + lines[0]
+	}
+	return lines
+}
+
+// Cues converts the dialogue of the script to cues ordered by start time,
+// see srtText for how styling is converted.
+func (a *Script) Cues() []Cue {
+	events := a.Events()
+	cues := make([]Cue, 0, len(events))
+	for _, e := range events {
+		if e.Comment {
+			continue
+		}
+		lines := srtText(e.Text)
+		if len(lines) == 0 {
+			continue
+		}
+		cues = append(cues, Cue{Start: e.Start, End: e.End, Lines: lines})
+	}
+
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Start < cues[j].Start })
+	for i := range cues {
+		cues[i].Index = i + 1
+	}
+	return cues
+}
+
+var srtOverride = map[string]string{
+	"<i>": `{\i1}`, "</i>": `{\i0}`,
+	"<b>": `{\b1}`, "</b>": `{\b0}`,
+	"<u>": `{\u1}`, "</u>": `{\u0}`,
+}
+
+// assLine converts SRT tags to override tags, {\anN} is kept as is.
+func assLine(s string) string {
+	return htmlTagRE.ReplaceAllStringFunc(s, func(tag string) string {
+		m := htmlTagRE.FindStringSubmatch(tag)
+		return srtOverride["<"+m[1]+strings.ToLower(m[2])+">"]
+	})
+}
+
+func assTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	cs := (d + 5*time.Millisecond) / (10 * time.Millisecond)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// NewScript creates a script with a single Default style showing cues.
+func NewScript(cues []Cue) *Script {
+	events := make([]Line, 0, len(cues)+1)
+	events = append(events, Line{Key: "Format", Value: defaultEventFormat})
+	for _, c := range cues {
+		text := make([]string, len(c.Lines))
+		for i, l := range c.Lines {
+			text[i] = assLine(l)
+		}
+		events = append(events, Line{
+			Key: "Dialogue",
+			Value: fmt.Sprintf(
+				"0,%s,%s,Default,,0,0,0,,%s",
+				assTime(c.Start),
+				assTime(c.End),
+				strings.Join(text, `\N`),
+			),
+		})
+	}
+
+	return &Script{Sections: []*Section{
+		{Name: sectionInfo, Lines: []Line{
+			{Key: "ScriptType", Value: "v4.00+"},
+			{Key: "PlayResX", Value: "384"},
+			{Key: "PlayResY", Value: "288"},
+			{Key: "WrapStyle", Value: "0"},
+			{Key: "ScaledBorderAndShadow", Value: "yes"},
+			{},
+		}},
+		{Name: sectionStyles, Lines: []Line{
+			{Key: "Format", Value: defaultStyleFormat},
+			{Key: "Style", Value: defaultStyle},
+			{},
+		}},
+		{Name: sectionEvents, Lines: events},
+	}}
+}
+
+func parseASSCues(r io.Reader) ([]Cue, error) {
+	a, err := ParseASS(r)
+	if a == nil {
+		return nil, err
+	}
+	return a.Cues(), err
+}
+
+func writeASSCues(w io.Writer, cues []Cue) error { return NewScript(cues).Write(w) }
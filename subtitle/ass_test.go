@@ -0,0 +1,94 @@
+package subtitle
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testASS = "\ufeff[Script Info]\r\n" +
+	"; Script generated by Aegisub\r\n" +
+	"Title: Breaking Bad\r\n" +
+	"ScriptType: v4.00+\r\n" +
+	"PlayResX:1920\r\n" +
+	"\r\n" +
+	"[V4+ Styles]\r\n" +
+	"Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\r\n" +
+	"Style: Default,Arial,48,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,2,2,10,10,10,1\r\n" +
+	"Style: Sign,Arial,36,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,-1,0,0,0,100,100,0,0,1,2,2,8,10,10,10,1\r\n" +
+	"\r\n" +
+	"[Events]\r\n" +
+	"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\r\n" +
+	"Dialogue: 0,0:00:03.00,0:00:05.25,Default,,0,0,0,,{\\i1}I live at{\\i0}\\N308 Negra Arroyo Lane, Albuquerque.\r\n" +
+	"Comment: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,timing note\r\n" +
+	"Dialogue: 0,0:00:01.00,0:00:02.50,Sign,,0,0,0,,{\\an8\\fs40\\c&H00FFFF&}Los Pollos Hermanos\r\n" +
+	"Dialogue: 1,0:00:01.00,0:00:02.50,Sign,,0,0,0,,{\\p1}m 0 0 l 100 0 100 100{\\p0}\r\n" +
+	"\r\n" +
+	"[Aegisub Project Garbage]\r\n" +
+	"Active Line: 2\r\n"
+
+func TestASSRoundTrip(t *testing.T) {
+	a, err := ParseASS(strings.NewReader(testASS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := a.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != testASS {
+		t.Errorf("round trip changed the script:\n%q", buf.String())
+	}
+
+	if a.Info("title") != "Breaking Bad" || a.Info("PlayResX") != "1920" {
+		t.Errorf("unexpected script info %q %q", a.Info("title"), a.Info("PlayResX"))
+	}
+	styles := a.Styles()
+	if len(styles) != 2 || styles[1]["Name"] != "Sign" || styles[1]["Alignment"] != "8" {
+		t.Errorf("unexpected styles %+v", styles)
+	}
+	events := a.Events()
+	if len(events) != 4 || !events[1].Comment || events[0].Text != `{\i1}I live at{\i0}\N308 Negra Arroyo Lane, Albuquerque.` {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestASSToSRT(t *testing.T) {
+	a, err := ParseASS(strings.NewReader(testASS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []Cue{
+		{1, time.Second, 2500 * time.Millisecond, []string{`{\an8}Los Pollos Hermanos`}},
+		{2, 3 * time.Second, 5250 * time.Millisecond, []string{"<i>I live at</i>", "308 Negra Arroyo Lane, Albuquerque."}},
+	}
+	if cues := a.Cues(); !reflect.DeepEqual(cues, exp) {
+		t.Fatalf("unexpected cues %+v", cues)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := NewScript(exp).Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseASS(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cues := b.Cues(); !reflect.DeepEqual(cues, exp) {
+		t.Errorf("SRT -> ASS -> SRT changed the cues %+v", cues)
+	}
+	if text := b.Events()[1].Text; text != `{\i1}I live at{\i0}\N308 Negra Arroyo Lane, Albuquerque.` {
+		t.Errorf("unexpected text %q", text)
+	}
+
+	_, err = ParseASS(strings.NewReader("[Events]\nDialogue: 0,0:00:xx.00,0:00:02.00,Default,,0,0,0,,bad\n"))
+	var perr ParseErrors
+	if !errors.As(err, &perr) || perr[0].Line != 2 {
+		t.Errorf("expected a ParseError on line 2, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package subtitle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frizinak/subscene/internal/tempfile"
+)
+
+// Format is a subtitle format, named after its file extension.
+type Format string
+
+const (
+	SRT Format = "srt"
+	VTT Format = "vtt"
+	ASS Format = "ass"
+	SSA Format = "ssa"
+)
+
+var ErrFormat = errors.New("unsupported subtitle format")
+
+var (
+	parsers = map[Format]func(io.Reader) ([]Cue, error){
+		SRT: ParseSRT,
+		VTT: ParseVTT,
+		ASS: parseASSCues,
+		SSA: parseASSCues,
+	}
+	writers = map[Format]func(io.Writer, []Cue) error{
+		SRT: WriteSRT,
+		VTT: WriteVTT,
+		ASS: writeASSCues,
+	}
+)
+
+// FormatOf returns the format of a file by its extension.
+func FormatOf(name string) Format {
+	return Format(strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")))
+}
+
+// Ext returns the file extension of f, including the dot.
+func (f Format) Ext() string { return "." + string(f) }
+
+// ReadFile parses the subtitle file at path according to its extension.
+func ReadFile(path string) ([]Cue, error) {
+	parse, ok := parsers[FormatOf(path)]
+	if !ok {
+		return nil, ErrFormat
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parse(f)
+}
+
+// WriteFile writes cues to path in the format of its extension. The file is
+// written to a temporary file first so a failure never leaves a truncated
+// subtitle behind.
+func WriteFile(path string, cues []Cue) error {
+	write, ok := writers[FormatOf(path)]
+	if !ok {
+		return ErrFormat
+	}
+
+	return writeFile(path, func(w io.Writer) error { return write(w, cues) })
+}
+
+// writeFile writes to a temporary file and renames it over path, which
+// keeps its permissions. A symlink is written through to its target.
+func writeFile(path string, write func(io.Writer) error) error {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+
+	f, err := tempfile.Create(path)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err = write(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// Convert writes the subtitle at path next to it in format to and returns
+// the path of the new file, an existing file is never overwritten.
+// Malformed cues are dropped, an error is only returned if none could be
+// parsed.
+func Convert(path string, to Format) (string, error) {
+	dst := strings.TrimSuffix(path, filepath.Ext(path)) + to.Ext()
+	if _, err := os.Lstat(dst); err == nil {
+		return dst, fmt.Errorf("%s: %w", dst, os.ErrExist)
+	}
+	return dst, writeFile(dst, func(w io.Writer) error { return ConvertTo(w, path, to) })
+}
+
+// ConvertTo writes the subtitle at path to w in format to, see Convert.
+func ConvertTo(w io.Writer, path string, to Format) error {
+	write, ok := writers[to]
+	if !ok {
+		return ErrFormat
+	}
+
+	cues, err := readCues(path)
+	if err != nil {
+		return err
+	}
+	return write(w, cues)
+}
+
+// textFile is an SRT or WebVTT file that is changed in place, leaving
+// everything it does not change as is.
+type textFile struct {
+	// raw are the lines of the file including their line endings.
+	raw []string
+	// lines are the lines as the parsers see them, with the blocks without
+	// cues blanked.
+	lines  []string
+	blocks []block
+}
+
+func newTextFile(text string, f Format) textFile {
+	t := textFile{raw: strings.SplitAfter(text, "\n")}
+	t.lines = make([]string, len(t.raw))
+	for i, l := range t.raw {
+		t.lines[i] = strings.TrimRight(l, "\r\n\t ")
+	}
+	t.lines[0] = strings.TrimPrefix(t.lines[0], bom)
+
+	id := srtID(t.lines)
+	if f == VTT {
+		blankVTTBlocks(t.lines, true)
+		id = vttID(t.lines)
+	}
+	t.blocks = cueBlocks(t.lines, id)
+	return t
+}
+
+// eol returns the line ending of line i.
+func (t textFile) eol(i int) string {
+	if eol := t.raw[i][len(strings.TrimRight(t.raw[i], "\r\n")):]; eol != "" {
+		return eol
+	}
+	return "\n"
+}
+
+// editFile rewrites the SRT or WebVTT file at path with edit, but only if
+// it parses without errors.
+func editFile(path string, edit func(textFile, Format) string) error {
+	if _, err := ReadFile(path); err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	f := FormatOf(path)
+	text := edit(newTextFile(string(b), f), f)
+	return writeFile(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, text)
+		return err
+	})
+}
+
+// readCues is ReadFile but only fails if no cues could be parsed at all.
+func readCues(path string) ([]Cue, error) {
+	cues, err := ReadFile(path)
+	var perr ParseErrors
+	if err != nil && (!errors.As(err, &perr) || len(cues) == 0) {
+		return nil, err
+	}
+	return cues, nil
+}
@@ -0,0 +1,183 @@
+package subtitle
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	hiSoundRE   = regexp.MustCompile(`\{[^}]*\}|\[[^\]]*\]|\([^)]*\)`)
+	hiSpeakerRE = regexp.MustCompile(`^((?:\s*(?:<[^>]*>|\{[^}]*\}))*\s*(?:[-–]\s*)?)\p{Lu}[\p{Lu}\d .'&-]*:(?:\s+|$)`)
+	emptyTagRE  = regexp.MustCompile(`(?i)<[ibu]>\s*</[ibu]>`)
+	hiEmptyRE   = regexp.MustCompile(`^(?:\s|<[^>]*>|\{[^}]*\}|[-–])*$`)
+	spacesRE    = regexp.MustCompile(`[ \t]{2,}`)
+	tagSpaceRE  = regexp.MustCompile(`^((?:<[^>]*>|\{[^}]*\})*)\s+|\s+((?:<[^>]*>|\{[^}]*\})*)$`)
+	dashRE      = regexp.MustCompile(`^((?:<[^>]*>|\{[^}]*\})*)[-–]\s*`)
+)
+
+func isLyrics(line string) bool { return strings.ContainsAny(line, "♪♫") }
+
+// stripHI removes sound descriptions, lyrics and speaker labels from the
+// lines of a single cue. A description may span multiple lines.
+func stripHI(lines []string) []string {
+	// Override blocks are matched only to skip them, {\pos(1,2)} is not a
+	// sound description.
+	text := hiSoundRE.ReplaceAllStringFunc(strings.Join(lines, "\n"), func(m string) string {
+		if m[0] == '{' {
+			return m
+		}
+		return ""
+	})
+
+	stripped := make([]string, 0, len(lines))
+	for _, l := range strings.Split(text, "\n") {
+		if isLyrics(l) {
+			continue
+		}
+		l = hiSpeakerRE.ReplaceAllString(l, "$1")
+		l = emptyTagRE.ReplaceAllString(l, "")
+		l = spacesRE.ReplaceAllString(l, " ")
+		l = tagSpaceRE.ReplaceAllString(l, "$1$2")
+		if hiEmptyRE.MatchString(l) {
+			continue
+		}
+		stripped = append(stripped, l)
+	}
+
+	// A dialogue dash makes no sense when one speaker is left.
+	if len(stripped) == 1 {
+		stripped[0] = dashRE.ReplaceAllString(stripped[0], "$1")
+	}
+	return stripped
+}
+
+// StripHI returns cues without hearing impaired annotations: sound
+// descriptions like [DOOR SLAMS] or (laughing), ♪ lyrics ♪ and speaker
+// labels like JOHN:. Cues left without text are dropped and the remaining
+// ones renumbered.
+func StripHI(cues []Cue) []Cue {
+	stripped := make([]Cue, 0, len(cues))
+	for _, c := range cues {
+		if c.Lines = stripHI(c.Lines); len(c.Lines) != 0 {
+			c.Index = len(stripped) + 1
+			stripped = append(stripped, c)
+		}
+	}
+	return stripped
+}
+
+// StripHI removes hearing impaired annotations from all dialogue events
+// like the StripHI function does, events left without text are removed.
+func (a *Script) StripHI() {
+	s := a.Section(sectionEvents)
+	if s == nil {
+		return
+	}
+
+	names := s.format(defaultEventFormat)
+	lines := s.Lines[:0]
+	for _, l := range s.Lines {
+		if !strings.EqualFold(l.Key, "Dialogue") {
+			lines = append(lines, l)
+			continue
+		}
+
+		values := strings.SplitN(l.Value, ",", len(names))
+		if len(values) != len(names) {
+			lines = append(lines, l)
+			continue
+		}
+		text := stripHI(strings.Split(values[len(values)-1], `\N`))
+		if len(text) == 0 {
+			continue
+		}
+		values[len(values)-1] = strings.Join(text, `\N`)
+		l.Value = strings.Join(values, ",")
+		lines = append(lines, l)
+	}
+	s.Lines = lines
+}
+
+// StripHIFile strips hearing impaired annotations from the subtitle at path
+// in place, keeping its format and everything but the text of the cues. The
+// file is left alone if it could not be parsed without errors.
+func StripHIFile(path string) error {
+	switch FormatOf(path) {
+	case ASS, SSA:
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		a, err := ParseASS(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		a.StripHI()
+		return writeFile(path, func(w io.Writer) error { return a.Write(w) })
+	}
+
+	return editFile(path, stripHIText)
+}
+
+// stripHIText strips the cues of an SRT or WebVTT file, SRT indices are
+// renumbered.
+func stripHIText(t textFile, f Format) string {
+	var b strings.Builder
+	next := len(t.raw)
+	if len(t.blocks) != 0 {
+		next = t.blocks[0].start
+	}
+	b.WriteString(strings.Join(t.raw[:next], ""))
+
+	var n int
+	for _, bl := range t.blocks {
+		// Blank lines and blocks without cues after the text are kept.
+		textEnd := bl.timing + 1
+		text := make([]string, 0, bl.end-textEnd)
+		for i := textEnd; i < bl.end; i++ {
+			if !isBlank(t.lines[i]) {
+				text = append(text, t.lines[i])
+				textEnd = i + 1
+			}
+		}
+		rest := t.raw[textEnd:bl.end]
+
+		if text = stripHI(text); len(text) == 0 {
+			for len(rest) != 0 && isBlank(rest[0]) {
+				rest = rest[1:]
+			}
+			b.WriteString(strings.Join(rest, ""))
+			continue
+		}
+
+		n++
+		switch {
+		case bl.start == bl.timing:
+		case f == SRT:
+			if bl.start == 0 && strings.HasPrefix(t.raw[0], bom) {
+				b.WriteString(bom)
+			}
+			b.WriteString(strconv.Itoa(n) + t.eol(bl.start))
+		default:
+			b.WriteString(t.raw[bl.start])
+		}
+		eol := t.eol(bl.timing)
+		b.WriteString(t.raw[bl.timing])
+		if !strings.HasSuffix(t.raw[bl.timing], "\n") {
+			b.WriteString(eol)
+		}
+		for i, l := range text {
+			b.WriteString(l)
+			if i != len(text)-1 || textEnd != len(t.raw) || strings.HasSuffix(t.raw[textEnd-1], "\n") {
+				b.WriteString(eol)
+			}
+		}
+		b.WriteString(strings.Join(rest, ""))
+	}
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package subtitle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStripHI(t *testing.T) {
+	cue := func(lines ...string) Cue { return Cue{Lines: lines} }
+	cues := []Cue{
+		cue("[DOOR SLAMS]"),
+		cue("JOHN: Who's there?"),
+		cue("- (laughing) Nobody.", "- MAN 2: Liar."),
+		cue("♪ Happy birthday to you ♪", "♪ Happy birthday ♪"),
+		cue("<i>SARAH: I told you</i>", "<i>[SIGHS]</i>"),
+		cue("<i>(laughs) Fine. [BEEP]</i>"),
+		cue("It's 10:30: go.", "(whispering"),
+		cue("quietly) Now."),
+		cue("- [GUNSHOT]", "- Get down!"),
+		cue("{\\an8}[THUNDER]"),
+	}
+	for i := range cues {
+		cues[i].Index = i + 1
+		cues[i].Start = time.Duration(i) * time.Second
+	}
+
+	got := StripHI(cues)
+	exp := [][]string{
+		{"Who's there?"},
+		{"- Nobody.", "- Liar."},
+		{"<i>I told you</i>"},
+		{"<i>Fine.</i>"},
+		{"It's 10:30: go.", "(whispering"},
+		{"quietly) Now."},
+		{"Get down!"},
+	}
+	if len(got) != len(exp) {
+		t.Fatalf("got %d cues, expected %d: %q", len(got), len(exp), got)
+	}
+	for i, c := range got {
+		if c.Index != i+1 {
+			t.Errorf("cue %d: index %d", i, c.Index)
+		}
+		if !reflect.DeepEqual(c.Lines, exp[i]) {
+			t.Errorf("cue %d: got %q, expected %q", i, c.Lines, exp[i])
+		}
+	}
+	if got[0].Start != time.Second {
+		t.Errorf("timing not kept: %s", got[0].Start)
+	}
+	if cues[0].Lines[0] != "[DOOR SLAMS]" {
+		t.Error("input cues modified")
+	}
+}
+
+func TestStripHIFile(t *testing.T) {
+	dir := t.TempDir()
+
+	srt := filepath.Join(dir, "a.srt")
+	data := "1\n00:00:01,000 --> 00:00:02,000\n[MUSIC]\n\n2\n00:00:03,000 --> 00:00:04,000\nBOB: Hi.\n"
+	if err := os.WriteFile(srt, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StripHIFile(srt); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(srt)
+	if exp := "1\n00:00:03,000 --> 00:00:04,000\nHi.\n"; string(b) != exp {
+		t.Errorf("got %q, expected %q", b, exp)
+	}
+
+	vtt := filepath.Join(dir, "a.vtt")
+	data = "WEBVTT\r\n\r\nintro\r\n00:01.000 --> 00:02.000\r\n[MUSIC]\r\n\r\nNOTE kept\r\n\r\n" +
+		"00:03.000 --> 00:04.000 line:0\r\nBOB: Hi &amp; bye.\r\n(sighs)\r\n"
+	if err := os.WriteFile(vtt, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StripHIFile(vtt); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(vtt)
+	if exp := "WEBVTT\r\n\r\nNOTE kept\r\n\r\n00:03.000 --> 00:04.000 line:0\r\nHi &amp; bye.\r\n"; string(b) != exp {
+		t.Errorf("got %q, expected %q", b, exp)
+	}
+
+	data = "1\n00:00:01,000 --> 00:00:02,000\n[MUSIC]\n\n2\n00:00:0x,000 --> 00:00:04,000\nbad\n"
+	if err := os.WriteFile(srt, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var perr ParseErrors
+	if err := StripHIFile(srt); !errors.As(err, &perr) {
+		t.Errorf("expected ParseErrors, got %v", err)
+	}
+	if b, _ = os.ReadFile(srt); string(b) != data {
+		t.Errorf("malformed srt was rewritten: %q", b)
+	}
+
+	ass := filepath.Join(dir, "a.ass")
+	data = strings.Join([]string{
+		"[Script Info]",
+		"Title: test",
+		"",
+		"[Events]",
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text",
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,[MUSIC]",
+		"Comment: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,[kept]",
+		"Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\\i1}BOB: Hi, you.{\\i0}\\N(sighs)",
+		"Dialogue: 0,0:00:05.00,0:00:06.00,Default,,0,0,0,,{\\fad(200,200)\\pos(320,50)}(laughs) Hello",
+		"",
+	}, "\n")
+	if err := os.WriteFile(ass, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := StripHIFile(ass); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(ass)
+	exp := strings.Join([]string{
+		"[Script Info]",
+		"Title: test",
+		"",
+		"[Events]",
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text",
+		"Comment: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,[kept]",
+		"Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,{\\i1}Hi, you.{\\i0}",
+		"Dialogue: 0,0:00:05.00,0:00:06.00,Default,,0,0,0,,{\\fad(200,200)\\pos(320,50)}Hello",
+		"",
+	}, "\n")
+	if string(b) != exp {
+		t.Errorf("got\n%s\nexpected\n%s", b, exp)
+	}
+}
@@ -0,0 +1,201 @@
+package subtitle
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var srtTimeRE = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{1,2})(?:[,.](\d+))?$`)
+
+// ParseTimestamp parses hh:mm:ss,mmm, leniently: hours are optional, '.' is
+// accepted instead of ',' and the fraction can have any number of digits.
+// This covers the timestamps of all supported formats.
+func ParseTimestamp(s string) (time.Duration, error) {
+	m := srtTimeRE.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+	sec, _ := strconv.Atoi(m[3])
+	frac := (m[4] + "000")[:3]
+	ms, _ := strconv.Atoi(frac)
+
+	return time.Duration(h)*time.Hour +
+		time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second +
+		time.Duration(ms)*time.Millisecond, nil
+}
+
+// parseTiming parses a "start --> end" line, anything after end (like
+// SRT's X1:… Y2:… positioning) is ignored.
+func parseTiming(line string) (start, end time.Duration, err error) {
+	parts := strings.SplitN(line, "-->", 2)
+	right := strings.Fields(parts[1])
+	if len(right) == 0 {
+		return 0, 0, errors.New("missing end time")
+	}
+	if start, err = ParseTimestamp(parts[0]); err != nil {
+		return
+	}
+	if end, err = ParseTimestamp(right[0]); err != nil {
+		return
+	}
+	if end < start {
+		err = errors.New("end time before start time")
+	}
+	return
+}
+
+// isTiming reports whether line is a "start --> end" line, dialogue that
+// merely contains an arrow is not.
+func isTiming(line string) bool {
+	parts := strings.SplitN(line, "-->", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	right := strings.Fields(parts[1])
+	return len(right) != 0 &&
+		srtTimeRE.MatchString(strings.TrimSpace(parts[0])) &&
+		srtTimeRE.MatchString(right[0])
+}
+
+func isIndex(line string) bool {
+	_, err := strconv.Atoi(strings.TrimSpace(line))
+	return err == nil
+}
+
+func isBlank(line string) bool { return strings.TrimSpace(line) == "" }
+
+func readLines(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1024*1024)
+	lines := make([]string, 0, 1024)
+	for sc.Scan() {
+		l := sc.Text()
+		if len(lines) == 0 {
+			l = strings.TrimPrefix(l, bom)
+		}
+		lines = append(lines, strings.TrimRight(l, "\r\t "))
+	}
+	return lines, sc.Err()
+}
+
+// ParseSRT parses a SubRip file.
+// It copes with CRLF line endings, a BOM, missing blank lines between cues,
+// missing indices and overlapping cues. Malformed cues are skipped and
+// reported in a ParseErrors, together with the cues that were parsed.
+func ParseSRT(r io.Reader) ([]Cue, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cues, errs := parseCues(lines, srtID(lines))
+	return cues, errs.err()
+}
+
+// srtID reports whether a line is a cue index. Without blank lines an index
+// can only be told apart from text by being a number right before a timing
+// line.
+func srtID(lines []string) func(i, prev int) bool {
+	return func(i, prev int) bool { return isIndex(lines[i]) }
+}
+
+// block is a cue in a file: its identifier or timing line, the timing line
+// and the first line after it that belongs to the next cue.
+type block struct{ start, timing, end int }
+
+// cueBlocks finds cues by their timing lines. id reports whether line i,
+// which directly precedes a timing line, is the identifier of that cue,
+// prev is the first line after the previous timing line.
+func cueBlocks(lines []string, id func(i, prev int) bool) []block {
+	blocks := make([]block, 0, len(lines)/4)
+	for i, l := range lines {
+		// A malformed timing line is still recognized by the index before
+		// it, so it can be reported.
+		malformed := strings.Contains(l, "-->") && i > 0 && isIndex(lines[i-1]) &&
+			(i == 1 || isBlank(lines[i-2]))
+		if !isTiming(l) && !malformed {
+			continue
+		}
+		b := block{i, i, len(lines)}
+		prev := 0
+		if len(blocks) != 0 {
+			prev = blocks[len(blocks)-1].timing + 1
+		}
+		if i > prev && !isBlank(lines[i-1]) && id(i-1, prev) {
+			b.start = i - 1
+		}
+		if len(blocks) != 0 {
+			blocks[len(blocks)-1].end = b.start
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// parseCues parses the cues cueBlocks finds.
+func parseCues(lines []string, id func(i, prev int) bool) ([]Cue, ParseErrors) {
+	blocks := cueBlocks(lines, id)
+
+	var errs ParseErrors
+	end := len(lines)
+	if len(blocks) != 0 {
+		end = blocks[0].start
+	}
+	for i := 0; i < end; i++ {
+		if !isBlank(lines[i]) {
+			errs = append(errs, &ParseError{i + 1, "unexpected text before the first cue"})
+			break
+		}
+	}
+
+	cues := make([]Cue, 0, len(blocks))
+	for _, b := range blocks {
+		start, stop, err := parseTiming(lines[b.timing])
+		if err != nil {
+			errs = append(errs, &ParseError{b.timing + 1, err.Error()})
+			continue
+		}
+
+		c := Cue{Start: start, End: stop, Lines: make([]string, 0, b.end-b.timing-1)}
+		if b.start != b.timing {
+			c.Index, _ = strconv.Atoi(strings.TrimSpace(lines[b.start]))
+		}
+		for _, l := range lines[b.timing+1 : b.end] {
+			if !isBlank(l) {
+				c.Lines = append(c.Lines, l)
+			}
+		}
+		cues = append(cues, c)
+	}
+
+	return cues, errs
+}
+
+// WriteSRT writes cues as a SubRip file. Cues without an Index are
+// numbered by their position.
+func WriteSRT(w io.Writer, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range cues {
+		index := c.Index
+		if index <= 0 {
+			index = i + 1
+		}
+		fmt.Fprintf(bw, "%d\n%s --> %s\n", index, timestamp(c.Start, ','), timestamp(c.End, ','))
+		for _, l := range c.Lines {
+			bw.WriteString(l)
+			bw.WriteByte('\n')
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,99 @@
+package subtitle
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSRT = `1
+00:00:01,000 --> 00:00:02,500
+My name is Walter Hartwell White.
+
+2
+00:00:03,000 --> 00:00:05,250
+<i>I live at</i>
+308 Negra Arroyo Lane.
+
+3
+01:02:03,004 --> 01:02:04,000
+Albuquerque, New Mexico.
+
+`
+
+func TestSRTRoundTrip(t *testing.T) {
+	cues, err := ParseSRT(strings.NewReader(testSRT))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []Cue{
+		{1, time.Second, 2500 * time.Millisecond, []string{"My name is Walter Hartwell White."}},
+		{2, 3 * time.Second, 5250 * time.Millisecond, []string{"<i>I live at</i>", "308 Negra Arroyo Lane."}},
+		{3, time.Hour + 2*time.Minute + 3004*time.Millisecond, time.Hour + 2*time.Minute + 4*time.Second, []string{"Albuquerque, New Mexico."}},
+	}
+	if !reflect.DeepEqual(cues, exp) {
+		t.Fatalf("unexpected cues %+v", cues)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := WriteSRT(buf, cues); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != testSRT {
+		t.Errorf("round trip changed the file:\n%s", buf.String())
+	}
+}
+
+func TestSRTLenient(t *testing.T) {
+	in := "\ufeff1\r\n" +
+		"00:00:01.5 --> 00:00:04,000 X1:10 X2:20\r\n" +
+		"First\r\n" +
+		"2\r\n" +
+		"0:00:02,000 --> 0:00:03,000\r\n" +
+		"Overlapping\r\n" +
+		"\r\n" +
+		"\r\n" +
+		"00:05,000 --> 00:06,000\r\n" +
+		"No index\r\n" +
+		"Go left --> now\r\n"
+
+	cues, err := ParseSRT(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []Cue{
+		{1, 1500 * time.Millisecond, 4 * time.Second, []string{"First"}},
+		{2, 2 * time.Second, 3 * time.Second, []string{"Overlapping"}},
+		{0, 5 * time.Second, 6 * time.Second, []string{"No index", "Go left --> now"}},
+	}
+	if !reflect.DeepEqual(cues, exp) {
+		t.Errorf("unexpected cues %+v", cues)
+	}
+}
+
+func TestSRTMalformed(t *testing.T) {
+	in := "garbage\n\n1\n00:00:01,000 --> 00:00:02,000\nok\n\n2\n00:00:0x,000 --> 00:00:02,000\nbad\n\n" +
+		"3\n00:00:05,000 --> 00:00:04,000\nbackwards\n\n4\n00:00:06,000 --> 00:00:07,000\nok\n"
+
+	cues, err := ParseSRT(strings.NewReader(in))
+	var perr ParseErrors
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected ParseErrors, got %v", err)
+	}
+
+	lines := make([]int, len(perr))
+	for i, e := range perr {
+		lines[i] = e.Line
+	}
+	if !reflect.DeepEqual(lines, []int{1, 8, 12}) {
+		t.Errorf("unexpected errors %v", err)
+	}
+	if len(cues) != 2 || cues[0].Index != 1 || cues[1].Index != 4 {
+		t.Errorf("expected the valid cues to be parsed, got %+v", cues)
+	}
+}
@@ -0,0 +1,61 @@
+// Package subtitle parses and writes subtitle files.
+package subtitle
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cue is a single subtitle, shown from Start until End.
+type Cue struct {
+	Index      int
+	Start, End time.Duration
+	Lines      []string
+}
+
+// ParseError describes a malformed part of a subtitle file.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string { return fmt.Sprintf("line %d: %s", e.Line, e.Msg) }
+
+// ParseErrors are all problems found while parsing a file. Parsers skip
+// what they can not make sense of, so ParseErrors is returned alongside
+// the cues that could be parsed.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e ParseErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+const bom = "\ufeff"
+
+// timestamp formats d as hh:mm:ss followed by sep and milliseconds.
+func timestamp(d time.Duration, sep byte) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf(
+		"%02d:%02d:%02d%c%03d",
+		ms/3600000,
+		ms/60000%60,
+		ms/1000%60,
+		sep,
+		ms%1000,
+	)
+}
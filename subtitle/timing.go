@@ -0,0 +1,162 @@
+package subtitle
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Retime maps a timestamp to a new one, see Shift, Stretch and Sync.
+type Retime func(time.Duration) time.Duration
+
+func linear(scale float64, offset time.Duration) Retime {
+	return func(t time.Duration) time.Duration {
+		return time.Duration(float64(t)*scale) + offset
+	}
+}
+
+// Shift moves all timestamps by d, which may be negative.
+func Shift(d time.Duration) Retime { return linear(1, d) }
+
+// Stretch converts the timing of a subtitle made for a video running at from
+// frames per second to one running at to, e.g.: Stretch(23.976, 25) for a
+// PAL release.
+func Stretch(from, to float64) Retime { return linear(from/to, 0) }
+
+// Then returns a Retime that applies r followed by next.
+func (r Retime) Then(next Retime) Retime {
+	return func(t time.Duration) time.Duration { return next(r(t)) }
+}
+
+func (r Retime) at(t time.Duration) time.Duration {
+	if t = r(t); t < 0 {
+		return 0
+	}
+	return t
+}
+
+// Apply retimes cues in place, timestamps that would become negative are
+// clamped to 0.
+func (r Retime) Apply(cues []Cue) {
+	for i := range cues {
+		cues[i].Start = r.at(cues[i].Start)
+		cues[i].End = r.at(cues[i].End)
+	}
+}
+
+// Anchor pins the start of the Cue-th cue, counting from 1, to At.
+type Anchor struct {
+	Cue int
+	At  time.Duration
+}
+
+var ErrAnchor = errors.New("invalid anchor")
+
+// Sync returns the Retime that linearly maps the cues of anchors a and b to
+// their new start times, correcting both an offset and a framerate
+// difference at once.
+func Sync(cues []Cue, a, b Anchor) (Retime, error) {
+	for _, an := range []Anchor{a, b} {
+		if an.Cue < 1 || an.Cue > len(cues) {
+			return nil, fmt.Errorf("%w: cue %d out of range 1-%d", ErrAnchor, an.Cue, len(cues))
+		}
+	}
+
+	s1, s2 := cues[a.Cue-1].Start, cues[b.Cue-1].Start
+	if s1 == s2 {
+		return nil, fmt.Errorf("%w: cues %d and %d start at the same time", ErrAnchor, a.Cue, b.Cue)
+	}
+
+	scale := float64(b.At-a.At) / float64(s2-s1)
+	return linear(scale, a.At-time.Duration(float64(s1)*scale)), nil
+}
+
+// Retime retimes all events in place, nothing but their Start and End
+// fields is changed.
+func (a *Script) Retime(r Retime) {
+	s := a.Section(sectionEvents)
+	if s == nil {
+		return
+	}
+
+	names := s.format(defaultEventFormat)
+	for i, l := range s.Lines {
+		if !isEvent(l.Key) {
+			continue
+		}
+		values := strings.SplitN(l.Value, ",", len(names))
+		for j := range values {
+			if names[j] != "Start" && names[j] != "End" {
+				continue
+			}
+			if t, err := ParseTimestamp(values[j]); err == nil {
+				values[j] = assTime(r.at(t))
+			}
+		}
+		s.Lines[i].Value = strings.Join(values, ",")
+	}
+}
+
+// RetimeFile retimes the subtitle at path in place, keeping its format.
+// Only timestamps are changed, everything else like WebVTT cue settings and
+// comments or the styles of an ASS script is kept. The file is left alone if
+// it could not be parsed without errors.
+func RetimeFile(path string, r Retime) error {
+	switch FormatOf(path) {
+	case ASS, SSA:
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		a, err := ParseASS(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		a.Retime(r)
+		return writeFile(path, func(w io.Writer) error { return a.Write(w) })
+	}
+
+	return editFile(path, func(t textFile, f Format) string { return retimeText(t, f, r) })
+}
+
+var timingRE = regexp.MustCompile(`^(\x{feff}?[ \t]*)([\d:.,]+)([ \t]*-->[ \t]*)([\d:.,]+)`)
+
+// retimeText retimes the timing lines of an SRT or WebVTT file.
+func retimeText(t textFile, f Format, r Retime) string {
+	sep := byte(',')
+	if f == VTT {
+		sep = '.'
+	}
+
+	raw := append([]string(nil), t.raw...)
+	for _, b := range t.blocks {
+		l := raw[b.timing]
+		m := timingRE.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		start, _ := ParseTimestamp(m[2])
+		end, _ := ParseTimestamp(m[4])
+		raw[b.timing] = m[1] + timestamp(r.at(start), sep) + m[3] + timestamp(r.at(end), sep) + l[len(m[0]):]
+	}
+	return strings.Join(raw, "")
+}
+
+// SyncFile retimes the subtitle at path with Sync.
+func SyncFile(path string, a, b Anchor) error {
+	cues, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	r, err := Sync(cues, a, b)
+	if err != nil {
+		return err
+	}
+	return RetimeFile(path, r)
+}
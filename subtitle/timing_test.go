@@ -0,0 +1,132 @@
+package subtitle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetime(t *testing.T) {
+	cues := func() []Cue {
+		return []Cue{
+			{1, time.Second, 2 * time.Second, nil},
+			{2, 10 * time.Second, 12 * time.Second, nil},
+			{3, 100 * time.Second, 101 * time.Second, nil},
+		}
+	}
+	times := func(cues []Cue) []time.Duration {
+		d := make([]time.Duration, 0, len(cues)*2)
+		for _, c := range cues {
+			d = append(d, c.Start, c.End)
+		}
+		return d
+	}
+
+	c := cues()
+	Shift(-1500 * time.Millisecond).Apply(c)
+	exp := []time.Duration{0, 500 * time.Millisecond, 8500 * time.Millisecond, 10500 * time.Millisecond, 98500 * time.Millisecond, 99500 * time.Millisecond}
+	if !reflect.DeepEqual(times(c), exp) {
+		t.Errorf("unexpected shift %v", times(c))
+	}
+
+	c = cues()
+	Stretch(25, 24).Then(Shift(time.Second)).Apply(c)
+	if c[2].Start.Round(time.Millisecond) != 105167*time.Millisecond {
+		t.Errorf("unexpected stretch %v", c[2].Start)
+	}
+
+	c = cues()
+	r, err := Sync(c, Anchor{2, 12 * time.Second}, Anchor{3, 192 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Apply(c)
+	exp = []time.Duration{0, 0, 12 * time.Second, 16 * time.Second, 192 * time.Second, 194 * time.Second}
+	if !reflect.DeepEqual(times(c), exp) {
+		t.Errorf("unexpected sync %v", times(c))
+	}
+
+	if _, err := Sync(c, Anchor{1, 0}, Anchor{4, 0}); !errors.Is(err, ErrAnchor) {
+		t.Errorf("expected ErrAnchor, got %v", err)
+	}
+}
+
+func TestRetimeFile(t *testing.T) {
+	dir := t.TempDir()
+	ass := filepath.Join(dir, "movie.ass")
+	if err := os.WriteFile(ass, []byte(testASS), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RetimeFile(ass, Shift(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(ass)
+	exp := strings.Replace(testASS, "0:00:03.00,0:00:05.25", "0:00:04.00,0:00:06.25", 1)
+	exp = strings.ReplaceAll(exp, "0:00:01.00,0:00:02.50", "0:00:02.00,0:00:03.50")
+	exp = strings.Replace(exp, "0:00:01.00,0:00:02.00", "0:00:02.00,0:00:03.00", 1)
+	if string(b) != exp {
+		t.Errorf("unexpected script after retiming:\n%q", b)
+	}
+
+	vtt := filepath.Join(dir, "movie.vtt")
+	in := "WEBVTT - Breaking Bad\n\nNOTE 00:00:01.000 --> 00:00:02.000\n\nintro\n00:01.000 --> 00:02.000 line:0\nTom &amp; Jerry\n"
+	if err := os.WriteFile(vtt, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SyncFile(vtt, Anchor{1, 0}, Anchor{1, time.Second}); !errors.Is(err, ErrAnchor) {
+		t.Errorf("expected ErrAnchor, got %v", err)
+	}
+	if err := RetimeFile(vtt, Shift(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(vtt)
+	if exp := "WEBVTT - Breaking Bad\n\nNOTE 00:00:01.000 --> 00:00:02.000\n\nintro\n00:00:02.000 --> 00:00:03.000 line:0\nTom &amp; Jerry\n"; string(b) != exp {
+		t.Errorf("unexpected vtt after retiming:\n%q", b)
+	}
+
+	srt := filepath.Join(dir, "movie.srt")
+	in = "1\r\n00:00:01,000 --> 00:00:02,000\r\nok\r\n\r\n2\r\n00:00:0x,000 --> 00:00:04,000\r\nbad\r\n"
+	if err := os.WriteFile(srt, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var perr ParseErrors
+	if err := RetimeFile(srt, Shift(time.Second)); !errors.As(err, &perr) {
+		t.Errorf("expected ParseErrors, got %v", err)
+	}
+	if b, _ = os.ReadFile(srt); string(b) != in {
+		t.Errorf("malformed srt was rewritten:\n%q", b)
+	}
+}
+
+func TestRetimeFileMode(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.srt")
+	if err := os.WriteFile(target, []byte(testSRT), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(target, 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "movie.srt")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip(err)
+	}
+
+	if err := RetimeFile(link, Shift(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := os.Lstat(link); err != nil || stat.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced: %v %v", stat.Mode(), err)
+	}
+	stat, err := os.Stat(target)
+	if err != nil || stat.Mode().Perm() != 0644 {
+		t.Errorf("expected 0644, got %v %v", stat.Mode(), err)
+	}
+	if b, _ := os.ReadFile(target); !strings.Contains(string(b), "00:00:02,000 --> 00:00:03,500") {
+		t.Errorf("target was not retimed:\n%s", b)
+	}
+}
@@ -0,0 +1,131 @@
+package subtitle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	assTagRE  = regexp.MustCompile(`\{\\[^}]*\}`)
+	htmlTagRE = regexp.MustCompile(`<\s*(/?)\s*([a-zA-Z]+)[^>]*>`)
+
+	vttEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+	// vttTags are the SRT tags WebVTT understands.
+	vttTags = map[string]struct{}{"i": {}, "b": {}, "u": {}}
+	// assStyle maps the override tags some SRT files contain to tags.
+	assStyle = map[string]string{
+		`{\i1}`: "<i>", `{\i0}`: "</i>",
+		`{\b1}`: "<b>", `{\b0}`: "</b>",
+		`{\u1}`: "<u>", `{\u0}`: "</u>",
+	}
+)
+
+// vttText keeps the italic, bold and underline tags of an SRT line and
+// escapes or drops everything else WebVTT would choke on.
+func vttText(s string) string {
+	s = assTagRE.ReplaceAllStringFunc(s, func(tag string) string {
+		return assStyle[strings.ToLower(tag)]
+	})
+
+	var b strings.Builder
+	for {
+		loc := htmlTagRE.FindStringSubmatchIndex(s)
+		if loc == nil {
+			b.WriteString(vttEscape.Replace(s))
+			return b.String()
+		}
+
+		b.WriteString(vttEscape.Replace(s[:loc[0]]))
+		closing, name := s[loc[2]:loc[3]], strings.ToLower(s[loc[4]:loc[5]])
+		if _, ok := vttTags[name]; ok {
+			b.WriteString("<" + closing + name + ">")
+		}
+		s = s[loc[1]:]
+	}
+}
+
+var vttUnescape = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp;", "\u00a0")
+
+// vttBlocks are blocks that hold no cues.
+var vttBlocks = []string{"NOTE", "STYLE", "REGION"}
+
+func isVTTBlock(line string) bool {
+	for _, b := range vttBlocks {
+		if line == b || strings.HasPrefix(line, b+" ") || strings.HasPrefix(line, b+"\t") {
+			return true
+		}
+	}
+	return false
+}
+
+// blankVTTBlocks blanks the header, if there is one, and all other blocks
+// without cues, keeping the line numbers intact.
+func blankVTTBlocks(lines []string, header bool) {
+	for i, skip := 0, header; i < len(lines); i++ {
+		if isBlank(lines[i]) {
+			skip = false
+			continue
+		}
+		if i == 0 || isBlank(lines[i-1]) {
+			skip = skip || isVTTBlock(lines[i])
+		}
+		if skip {
+			lines[i] = ""
+		}
+	}
+}
+
+// vttID reports whether a line is a cue identifier, which is always
+// preceded by a blank line.
+func vttID(lines []string) func(i, prev int) bool {
+	return func(i, prev int) bool { return i == 0 || isBlank(lines[i-1]) }
+}
+
+// ParseVTT parses a WebVTT file. Comments, styles and regions are skipped,
+// as are cue identifiers that are not numbers and cue settings.
+// Errors are reported like ParseSRT does.
+func ParseVTT(r io.Reader) ([]Cue, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs ParseErrors
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "WEBVTT") {
+		errs = append(errs, &ParseError{1, "missing WEBVTT header"})
+	}
+
+	blankVTTBlocks(lines, len(errs) == 0)
+
+	cues, perrs := parseCues(lines, vttID(lines))
+	for i := range cues {
+		for j, l := range cues[i].Lines {
+			cues[i].Lines[j] = vttUnescape.Replace(l)
+		}
+	}
+
+	return cues, append(errs, perrs...).err()
+}
+
+// WriteVTT writes cues as a WebVTT file, the Index of a cue is used as its
+// identifier.
+func WriteVTT(w io.Writer, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		if c.Index > 0 {
+			fmt.Fprintf(bw, "%d\n", c.Index)
+		}
+		fmt.Fprintf(bw, "%s --> %s\n", timestamp(c.Start, '.'), timestamp(c.End, '.'))
+		for _, l := range c.Lines {
+			bw.WriteString(vttText(l))
+			bw.WriteByte('\n')
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,62 @@
+package subtitle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVTT(t *testing.T) {
+	tests := map[string]string{
+		"<i>italic</i> and <B>bold</B>":       "<i>italic</i> and <b>bold</b>",
+		`{\i1}italic{\i0} {\an8}top`:          "<i>italic</i> top",
+		`<font color="#ffff00">yellow</font>`: "yellow",
+		"Tom & Jerry <3 -->":                  "Tom &amp; Jerry &lt;3 --&gt;",
+	}
+	for in, exp := range tests {
+		if got := vttText(in); got != exp {
+			t.Errorf("%q: expected %q, got %q", in, exp, got)
+		}
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "movie.srt")
+	if err := os.WriteFile(src, []byte(testSRT), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := Convert(src, VTT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != filepath.Join(dir, "movie.vtt") {
+		t.Errorf("unexpected destination %s", dst)
+	}
+	if _, err := Convert(src, VTT); !errors.Is(err, os.ErrExist) {
+		t.Errorf("expected an existing vtt to be kept, got %v", err)
+	}
+
+	b, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `WEBVTT
+
+1
+00:00:01.000 --> 00:00:02.500
+My name is Walter Hartwell White.
+
+2
+00:00:03.000 --> 00:00:05.250
+<i>I live at</i>
+308 Negra Arroyo Lane.
+
+3
+01:02:03.004 --> 01:02:04.000
+Albuquerque, New Mexico.
+
+`
+	if string(b) != exp {
+		t.Errorf("unexpected vtt:\n%s", b)
+	}
+}